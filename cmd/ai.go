@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -136,7 +135,7 @@ type aiImportMsg struct {
 
 func aiMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -148,6 +147,7 @@ func aiMain() {
 		log.Fatalln(err)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 func aiSub(wg *sync.WaitGroup) {
@@ -158,21 +158,10 @@ func aiSub(wg *sync.WaitGroup) {
 	errCheckList = strings.Split(strings.ToLower(aiErrorLevels), ",")
 	warnCheckList = strings.Split(strings.ToLower(aiWarnLevels), ",")
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	setupTimeGrinder()
 	i := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			i++
 			if matchFilter(&l) {
@@ -181,7 +170,7 @@ func aiSub(wg *sync.WaitGroup) {
 				switch level {
 				case "ERROR":
 					aiErrorCount++
-					nl := normalizeLog(l)
+					nl := normalizeLog(tg, l)
 					if p, ok := errorLogMap[nl]; !ok {
 						errorLogMap[nl] = &aiErrorPattern{
 							Pattern: nl,
@@ -212,10 +201,10 @@ func aiSub(wg *sync.WaitGroup) {
 				teaProg.Send(aiImportMsg{Lines: i, Hit: hit, Dur: time.Since(st)})
 			}
 			if stopSearch {
-				break
+				return false
 			}
-		}
-		return nil
+			return true
+		})
 	})
 	teaProg.Send(aiImportMsg{Done: true, Lines: i, Hit: hit, Dur: time.Since(st)})
 }
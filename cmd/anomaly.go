@@ -72,7 +72,7 @@ type anomalyMsg struct {
 
 func anomalyMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -85,6 +85,7 @@ func anomalyMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type anomalyEnt struct {
@@ -105,34 +106,19 @@ func anomalySub(wg *sync.WaitGroup) {
 		filterList = append(filterList, getSimpleFilter(extract))
 	}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
-			l := string(v)
-			lines++
-			if matchFilter(&l) {
-				hit++
-				results = append(results, l)
-				times = append(times, t)
-			}
-			if lines%100 == 0 {
-				teaProg.Send(anomalyMsg{Phase: "Search", Lines: lines, Hit: hit, Dur: time.Since(st)})
-			}
-			if stopSearch {
-				break
-			}
+	lines, hit, scanErr = scanLogsParallel(sti, eti, scanOpt{
+		Ordered: true,
+		Progress: func(lines, hit int) {
+			teaProg.Send(anomalyMsg{Phase: "Search", Lines: lines, Hit: hit, Dur: time.Since(st)})
+		},
+	}, func(tx *bbolt.Tx) func(e *logEnt) (bool, bool) {
+		return func(e *logEnt) (bool, bool) {
+			return true, matchFilter(&e.Log)
 		}
-		return nil
+	}, func(e *logEnt, _ bool) bool {
+		results = append(results, e.Log)
+		times = append(times, e.Time)
+		return true
 	})
 	switch anomalyMode {
 	case "sql":
@@ -0,0 +1,139 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// Column names of sources
+//
+// Header lines of W3C extended log (#Fields:), Zeek (#fields) and CSV/TSV
+// are saved in Columns of the source at import, so that the value of
+// the log can be read by column name.
+
+var regexpHeaderColumn = regexp.MustCompile(`^[A-Za-z_][\w .()\-/]*$`)
+
+// getHeaderColumns : get column names and separator from header line.
+// CSV/TSV header is checked only when csvHeader is true.
+func getHeaderColumns(l string, csvHeader bool) ([]string, string) {
+	switch {
+	case strings.HasPrefix(l, "#Fields:"):
+		return strings.Fields(l[len("#Fields:"):]), " "
+	case strings.HasPrefix(l, "#fields\t"):
+		return strings.Split(l[len("#fields\t"):], "\t"), "\t"
+	}
+	if !csvHeader {
+		return nil, ""
+	}
+	sep := ","
+	if strings.Contains(l, "\t") {
+		sep = "\t"
+	}
+	a := strings.Split(l, sep)
+	if len(a) < 3 {
+		return nil, ""
+	}
+	for i := range a {
+		a[i] = strings.TrimSpace(strings.Trim(a[i], `"`))
+		if !regexpHeaderColumn.MatchString(a[i]) {
+			return nil, ""
+		}
+	}
+	return a, sep
+}
+
+type sourceColumns struct {
+	sep   string
+	index map[string]int
+	// tagged is the source of inventory host that logs have the tag of host
+	tagged bool
+}
+
+// columnMap : columns of sources keyed by source ID
+type columnMap map[string]*sourceColumns
+
+// getColumnMap : get columns of sources that have header
+func getColumnMap(tx *bbolt.Tx) columnMap {
+	r := make(columnMap)
+	b := tx.Bucket([]byte("sources"))
+	if b == nil {
+		return r
+	}
+	b.ForEach(func(k, v []byte) error {
+		var s sourceEnt
+		if err := json.Unmarshal(v, &s); err != nil || len(s.Columns) < 1 {
+			return nil
+		}
+		c := &sourceColumns{sep: s.ColumnSep, index: make(map[string]int), tagged: s.Host != ""}
+		for i, n := range s.Columns {
+			if _, ok := c.index[n]; !ok {
+				c.index[n] = i
+			}
+		}
+		r[string(k)] = c
+		return nil
+	})
+	return r
+}
+
+// has : check any source has the column
+func (m columnMap) has(name string) bool {
+	for _, c := range m {
+		if _, ok := c.index[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// value : get value of column from log
+func (m columnMap) value(k []byte, l, name string) (string, bool) {
+	c, ok := m[getSourceID(k)]
+	if !ok {
+		return "", false
+	}
+	i, ok := c.index[name]
+	if !ok {
+		return "", false
+	}
+	if c.tagged {
+		l = trimHostTag(l)
+	}
+	var f []string
+	if c.sep == " " {
+		f = strings.Fields(l)
+	} else {
+		r := csv.NewReader(strings.NewReader(l))
+		r.Comma = rune(c.sep[0])
+		r.LazyQuotes = true
+		r.FieldsPerRecord = -1
+		var err error
+		if f, err = r.Read(); err != nil {
+			f = strings.Split(l, c.sep)
+		}
+	}
+	if i >= len(f) {
+		return "", false
+	}
+	v := strings.TrimSpace(f[i])
+	return v, v != "" && v != "-"
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestGetHeaderColumns(t *testing.T) {
+	tests := []struct {
+		line string
+		csv  bool
+		want []string
+		sep  string
+	}{
+		{"#Fields: date time s-ip cs-method cs-uri-stem sc-status", false, []string{"date", "time", "s-ip", "cs-method", "cs-uri-stem", "sc-status"}, " "},
+		{"#fields\tts\tuid\tid.orig_h", false, []string{"ts", "uid", "id.orig_h"}, "\t"},
+		{"Time,Source IP,Action,User(Name)", true, []string{"Time", "Source IP", "Action", "User(Name)"}, ","},
+		{`"time","src","dst"`, true, []string{"time", "src", "dst"}, ","},
+		{"time\tsrc\tdst", true, []string{"time", "src", "dst"}, "\t"},
+		{"Time,Source IP,Action", false, nil, ""},
+		{"2024-01-01 10:00:00,192.168.1.1,allow", true, nil, ""},
+		{"#Software: Microsoft Internet Information Services 10.0", false, nil, ""},
+		{"a,b", true, nil, ""},
+	}
+	for _, tt := range tests {
+		got, sep := getHeaderColumns(tt.line, tt.csv)
+		if !reflect.DeepEqual(got, tt.want) || sep != tt.sep {
+			t.Errorf("getHeaderColumns(%q) = %q %q, want %q %q", tt.line, got, sep, tt.want, tt.sep)
+		}
+	}
+}
+
+func TestColumnImport(t *testing.T) {
+	setupImportTest(t)
+	sources := []struct {
+		path string
+		log  string
+	}{
+		{"u_ex240501.log", `#Software: Microsoft Internet Information Services 10.0
+#Fields: date time s-ip cs-method cs-uri-stem c-ip sc-status
+2024-05-01 10:00:00 10.0.0.1 GET /index.html 192.168.1.5 200
+2024-05-01 10:00:01 10.0.0.1 POST /login 192.168.1.6 401
+`},
+		{"fw.csv", `time,src,action,user
+2024-05-01T10:00:02Z,192.168.1.7,deny,"smith, john"
+2024-05-01T10:00:03Z,192.168.1.5,allow,alice
+`},
+		{"app.log", "2024-05-01T10:00:04Z app,start,ok\n"},
+	}
+	runImportTest(func() {
+		for _, s := range sources {
+			doImport(s.path, strings.NewReader(s.log))
+		}
+	})
+	get := func(name string) []string {
+		r := []string{}
+		db.View(func(tx *bbolt.Tx) error {
+			cols := getColumnMap(tx)
+			if !cols.has(name) {
+				return nil
+			}
+			scanLogs(tx, 0, 1<<62, func(ti int64, k, v []byte) bool {
+				if val, ok := cols.value(k, string(v), name); ok {
+					r = append(r, val)
+				}
+				return true
+			})
+			return nil
+		})
+		sort.Strings(r)
+		return r
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"c-ip", []string{"192.168.1.5", "192.168.1.6"}},
+		{"sc-status", []string{"200", "401"}},
+		{"src", []string{"192.168.1.5", "192.168.1.7"}},
+		{"user", []string{"alice", "smith, john"}},
+		{"nothing", []string{}},
+	}
+	for _, tt := range tests {
+		if got := get(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("column %s got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
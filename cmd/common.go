@@ -46,6 +46,9 @@ var pos int
 // common data
 type errMsg error
 
+// scanErr : error of scan like broken block of datastore. Results of analysis are partial.
+var scanErr error
+
 var db *bbolt.DB
 var teaProg *tea.Program
 var st time.Time
@@ -94,10 +97,31 @@ func openDB() error {
 		if _, err := tx.CreateBucketIfNotExists([]byte("delta")); err != nil {
 			return fmt.Errorf("create bucket: %s", err)
 		}
-		return nil
+		return setupSourceID(tx)
 	})
 }
 
+// openDBReadOnly : open bbolt DB for analysis.
+// Read only open shares the lock with other readers and works on read only media.
+// When the datastore is locked by import, the snapshot written by import is used.
+func openDBReadOnly() error {
+	if _, err := os.Stat(dataStore); err != nil {
+		return err
+	}
+	var err error
+	db, err = bbolt.Open(dataStore, 0600, &bbolt.Options{Timeout: 3 * time.Second, ReadOnly: true})
+	if err != bbolt.ErrTimeout {
+		return err
+	}
+	snap := getSnapshotPath()
+	if _, serr := os.Stat(snap); serr != nil {
+		return fmt.Errorf("%s is locked by another process", dataStore)
+	}
+	fmt.Fprintf(os.Stderr, "%s is locked. use snapshot %s\n", dataStore, snap)
+	db, err = bbolt.Open(snap, 0600, &bbolt.Options{Timeout: 3 * time.Second, ReadOnly: true})
+	return err
+}
+
 // getSimpleFilter : get filter from like test* test?k
 func getSimpleFilter(f string) *regexp.Regexp {
 	if f == "" {
@@ -307,11 +331,13 @@ var notFilterList []*regexp.Regexp
 func setupFilter(args []string) {
 	filterList = []*regexp.Regexp{}
 	notFilterList = []*regexp.Regexp{}
+	simpleFilterList = []string{}
 	if regexpFilter != "" {
 		filterList = append(filterList, getFilter(regexpFilter))
 	}
 	if simpleFilter != "" {
 		filterList = append(filterList, getSimpleFilter(simpleFilter))
+		simpleFilterList = append(simpleFilterList, simpleFilter)
 	}
 	for _, s := range args {
 		if s != "" {
@@ -319,6 +345,7 @@ func setupFilter(args []string) {
 				notFilterList = append(notFilterList, getSimpleFilter(s[1:]))
 			} else {
 				filterList = append(filterList, getSimpleFilter(s))
+				simpleFilterList = append(simpleFilterList, s)
 			}
 		}
 	}
@@ -494,3 +521,10 @@ func maskPII(s string) string {
 	s = regexpUUID.ReplaceAllString(s, "<UUID>")
 	return s
 }
+
+// checkScanErr : report error of scan after view of analysis is closed
+func checkScanErr() {
+	if scanErr != nil {
+		log.Fatalf("scan logs: %v (results are partial)", scanErr)
+	}
+}
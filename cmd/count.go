@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -29,13 +28,13 @@ import (
 	"sync"
 	"time"
 
-	"github.com/PaesslerAG/jsonpath"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/dustin/go-humanize"
+	"github.com/gravwell/gravwell/v3/timegrinder"
 	"github.com/spf13/cobra"
 	"go.etcd.io/bbolt"
 )
@@ -53,6 +52,8 @@ Count word in logs.
  $twsla count -e word
 Count json key.
  $twsla count -e json -n Score
+Count key=value of log.
+ $twsla count -e kv -n user
 Count field of log
  $twsla count -e field -p 0
 Count csv of log
@@ -73,7 +74,7 @@ func init() {
 	countCmd.Flags().IntVarP(&interval, "interval", "i", 0, "Specify the aggregation interval in seconds.")
 	countCmd.Flags().IntVarP(&pos, "pos", "p", 1, "Specify variable location")
 	countCmd.Flags().IntVar(&delayFilter, "delay", 0, "Delay filter")
-	countCmd.Flags().StringVarP(&extract, "extract", "e", "", "Extract pattern or mode. mode is json,grok,word,normalize")
+	countCmd.Flags().StringVarP(&extract, "extract", "e", "", "Extract pattern or mode. mode is json,kv,grok,word,normalize")
 	countCmd.Flags().StringVarP(&name, "name", "n", "", "Name of key")
 	countCmd.Flags().StringVarP(&grokPat, "grokPat", "x", "", "grok pattern")
 	countCmd.Flags().StringVarP(&grokDef, "grok", "g", "", "grok pattern definitions")
@@ -81,13 +82,14 @@ func init() {
 	countCmd.Flags().StringVar(&ipInfoMode, "ip", "", "IP info mode(host|domain|loc|country)")
 	countCmd.Flags().IntVarP(&posDelay, "timePos", "q", 0, "Specify second time stamp position")
 	countCmd.Flags().BoolVar(&utc, "utc", false, "Force UTC")
+	countCmd.Flags().StringVar(&sourceFilter, "source", "", "Source path filter")
 }
 
 var mean float64
 
 func countMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -100,6 +102,7 @@ func countMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type countEnt struct {
@@ -117,10 +120,11 @@ func countSub(wg *sync.WaitGroup) {
 	mode := 0
 	ipm := getIPInfoMode()
 	switch extract {
-	case "json":
+	case "json", "kv":
 		mode = 1
 	case "grok":
-		mode = 2
+		mode = 1
+		setStoredGrok()
 		setGrok()
 		if gr == nil {
 			log.Fatalln("no grok")
@@ -171,123 +175,97 @@ func countSub(wg *sync.WaitGroup) {
 	}
 	intv := int64(getInterval()) * 1000 * 1000 * 1000
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	i := 0
-	hit := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		bd := tx.Bucket([]byte("delta"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
+	var i, hit int
+	i, hit, scanErr = scanLogsParallel(sti, eti, scanOpt{
+		Delta: delayFilter > 0 && posDelay == 0,
+		Progress: func(lines, hit int) {
+			teaProg.Send(SearchMsg{Lines: lines, Hit: hit, Dur: time.Since(st)})
+		},
+	}, func(tx *bbolt.Tx) func(e *logEnt) ([]string, bool) {
+		fb := getFieldBucket(tx, extract, name)
+		cols := getColumnMap(tx)
+		useCols := mode == 7 && cols.has(name)
+		wtg := tg
+		if mode == 4 || posDelay > 0 {
+			wtg, _ = newTimeGrinder(posDelay == 0)
+		}
+		return func(e *logEnt) ([]string, bool) {
+			if !matchFilter(&e.Log) {
+				return nil, false
 			}
-			l := string(v)
-			i++
-			if matchFilter(&l) {
-				if delayFilter > 0 {
-					dth := int64(delayFilter) * (1000 * 1000 * 1000)
-					if posDelay > 0 {
-						t2 := getTimestamp(v)
-						if t2 == 0 || dth < (t-t2) {
-							continue
-						}
-					} else {
-						vd := bd.Get(k)
-						if vd == nil {
-							continue
-						}
-						d, err := strconv.ParseFloat(string(vd), 64)
-						if err != nil || -d < float64(dth) {
-							continue
-						}
+			if delayFilter > 0 {
+				dth := int64(delayFilter) * (1000 * 1000 * 1000)
+				if posDelay > 0 {
+					t2 := getTimestamp(wtg, []byte(e.Log))
+					if t2 == 0 || dth < (e.Time-t2) {
+						return nil, false
 					}
-				}
-				switch mode {
-				case 1:
-					// JSON
-					var data map[string]interface{}
-					if ji := strings.IndexByte(string(v), '{'); ji >= 0 {
-						if err := json.Unmarshal(v[ji:], &data); err == nil {
-							if val, err := jsonpath.Get(name, data); err == nil && val != nil {
-								ck := fmt.Sprintf("%v", val)
-								if ipm > 0 {
-									ck = getIPInfo(ck, ipm)
-								}
-								countMap[ck]++
-								hit++
-							}
-						}
+				} else {
+					if e.Delta == nil {
+						return nil, false
 					}
-				case 2:
-					// GROK
-					if data, err := gr.ParseString(l); err == nil {
-						if ck, ok := data[name]; ok {
-							if ipm > 0 {
-								ck = getIPInfo(ck, ipm)
-							}
-							countMap[ck]++
-							hit++
-						}
+					d, err := strconv.ParseFloat(string(e.Delta), 64)
+					if err != nil || -d < float64(dth) {
+						return nil, false
 					}
-				case 3:
-					// TIME
-					d := t / intv
-					ck := time.Unix(0, d*intv).Format("2006/01/02 15:04")
-					countMap[ck]++
-					hit++
-				case 4:
-					ck := normalizeLog(l)
-					countMap[ck]++
-					hit++
-				case 5:
-					words := strings.Fields(strings.ToLower(l))
-					for _, word := range words {
-						if len(word) >= 2 && len(word) <= 50 {
-							word = strings.Trim(word, ".,!?;:()[]{}\"'")
-							if len(word) >= 2 {
-								countMap[word]++
-							}
+				}
+			}
+			keys := []string{}
+			switch mode {
+			case 1:
+				// JSON,KV,GROK
+				if ck, ok := getField(fb, extract, name, e.Key, []byte(e.Log)); ok {
+					keys = append(keys, ck)
+				}
+			case 3:
+				// TIME
+				d := e.Time / intv
+				keys = append(keys, time.Unix(0, d*intv).Format("2006/01/02 15:04"))
+			case 4:
+				keys = append(keys, normalizeLog(wtg, e.Log))
+			case 5:
+				words := strings.Fields(strings.ToLower(e.Log))
+				for _, word := range words {
+					if len(word) >= 2 && len(word) <= 50 {
+						word = strings.Trim(word, ".,!?;:()[]{}\"'")
+						if len(word) >= 2 {
+							keys = append(keys, word)
 						}
 					}
-				case 6:
-					f := strings.Fields(l)
-					if len(f) > pos {
-						k := f[pos]
-						countMap[k]++
-					}
-				case 7:
-					f := strings.Split(l, sep)
-					if len(f) > pos {
-						k := strings.TrimSpace(f[pos])
-						countMap[k]++
-					}
-				default:
-					// TWSLA
-					a := extPat.ExtReg.FindAllStringSubmatch(l, -1)
-					if len(a) >= extPat.Index && len(a[extPat.Index-1]) > 1 {
-						ck := a[extPat.Index-1][1]
-						if ipm > 0 {
-							ck = getIPInfo(ck, ipm)
-						}
-						countMap[ck]++
-						hit++
+				}
+			case 6:
+				f := strings.Fields(e.Log)
+				if len(f) > pos {
+					keys = append(keys, f[pos])
+				}
+			case 7:
+				if useCols {
+					if v, ok := cols.value(e.Key, e.Log, name); ok {
+						keys = append(keys, v)
 					}
+					break
+				}
+				f := strings.Split(e.Log, sep)
+				if len(f) > pos {
+					keys = append(keys, strings.TrimSpace(f[pos]))
+				}
+			default:
+				// TWSLA
+				a := extPat.ExtReg.FindAllStringSubmatch(e.Log, -1)
+				if len(a) >= extPat.Index && len(a[extPat.Index-1]) > 1 {
+					keys = append(keys, a[extPat.Index-1][1])
 				}
 			}
-			if i%100 == 0 {
-				teaProg.Send(SearchMsg{Lines: i, Hit: hit, Dur: time.Since(st)})
-			}
-			if stopSearch {
-				break
+			return keys, len(keys) > 0
+		}
+	}, func(e *logEnt, keys []string) bool {
+		for _, ck := range keys {
+			if ipm > 0 && (mode == 1 || mode == 0) {
+				ck = getIPInfo(ck, ipm)
 			}
+			countMap[ck]++
 		}
-		return nil
+		return true
 	})
 	for k, v := range countMap {
 		countList = append(countList, countEnt{
@@ -673,7 +651,7 @@ var regEmail = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Z|a-z]
 var regIP = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b`)
 var regMAC = regexp.MustCompile(`\b(?:[0-9a-fA-F]{2}[:-]){5}(?:[0-9a-fA-F]{2})\b`)
 
-func normalizeLog(msg string) string {
+func normalizeLog(tg *timegrinder.TimeGrinder, msg string) string {
 	normalized := ""
 	// Replace common variable patterns
 	s, e, ok := tg.Match([]byte(msg))
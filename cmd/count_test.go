@@ -29,7 +29,7 @@ func TestNormalizeLog(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := normalizeLog(tt.input)
+		got := normalizeLog(tg, tt.input)
 		if got != tt.want {
 			t.Errorf("normalizeLog(%q) = %q, want %q", tt.input, got, tt.want)
 		}
@@ -0,0 +1,625 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.etcd.io/bbolt"
+)
+
+// Datastore format
+//
+// format 1 : logs bucket has one log per key.
+// format 2 : logs bucket has zstd compressed blocks of logs.
+// The key of the block is the key of the first log in the block.
+// Blocks never overlap, so logs are read in key order.
+const (
+	formatRaw   = "1"
+	formatBlock = "2"
+)
+
+// maxBlockLogs : max number of logs in one compressed block
+const maxBlockLogs = 1000
+
+var compressLog bool
+
+type dataStoreInfo struct {
+	Indexed    bool
+	Compressed bool
+	Fields     string
+	Partition  string
+}
+
+func getMeta(tx *bbolt.Tx, k string) string {
+	b := tx.Bucket([]byte("meta"))
+	if b == nil {
+		return ""
+	}
+	return string(b.Get([]byte(k)))
+}
+
+func setMeta(tx *bbolt.Tx, k, v string) error {
+	b, err := tx.CreateBucketIfNotExists([]byte("meta"))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(k), []byte(v))
+}
+
+func isCompressed(tx *bbolt.Tx) bool {
+	return getMeta(tx, "format") == formatBlock
+}
+
+func getDataStoreInfo() dataStoreInfo {
+	r := dataStoreInfo{}
+	db.View(func(tx *bbolt.Tx) error {
+		r.Indexed = isIndexed(tx)
+		r.Compressed = isCompressed(tx)
+		r.Fields = getMeta(tx, "fields")
+		r.Partition = getMeta(tx, "partition")
+		return nil
+	})
+	return r
+}
+
+// setupCompress : use compressed format for new datastore
+func setupCompress() error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		if getMeta(tx, "format") != "" {
+			return nil
+		}
+		if k, _ := tx.Bucket([]byte("logs")).Cursor().First(); k != nil {
+			return fmt.Errorf("datastore is not empty. use twsla db compact")
+		}
+		return setMeta(tx, "format", formatBlock)
+	})
+}
+
+// Snapshot
+//
+// Import holds the write lock of the datastore until the end.
+// With snapshot interval, import copies the datastore to the snapshot file
+// after saving logs, so analysis commands can read it while importing.
+var snapshotInterval int
+var lastSnapshot time.Time
+
+func getSnapshotPath() string {
+	return dataStore + ".snapshot"
+}
+
+// writeSnapshot : copy datastore to snapshot file when interval has passed
+func writeSnapshot(force bool) error {
+	if snapshotInterval < 1 {
+		return nil
+	}
+	if !force && time.Since(lastSnapshot) < time.Duration(snapshotInterval)*time.Second {
+		return nil
+	}
+	lastSnapshot = time.Now()
+	snap := getSnapshotPath()
+	tmp := snap + ".tmp"
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(tmp, 0600)
+	}); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, snap)
+}
+
+// removeSnapshot : remove snapshot after import because datastore is not locked
+func removeSnapshot() {
+	if snapshotInterval > 0 {
+		os.Remove(getSnapshotPath())
+	}
+}
+
+// Partitioned layout
+//
+// When meta "partition" is day or hour, logs bucket has one bucket per partition.
+// The key of the partition bucket is the start time of the partition in the same hex
+// format as log keys, so partitions are read in time order and time range queries
+// only touch the partitions in range. Each partition uses the datastore format.
+var partitionLog string
+
+func getPartitionSize(p string) (int64, error) {
+	switch p {
+	case "":
+		return 0, nil
+	case "day":
+		return int64(24 * time.Hour), nil
+	case "hour":
+		return int64(time.Hour), nil
+	}
+	return 0, fmt.Errorf("invalid partition %s", p)
+}
+
+// setupPartition : use partitioned layout for new datastore
+func setupPartition() error {
+	if _, err := getPartitionSize(partitionLog); err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		if p := getMeta(tx, "partition"); p != "" {
+			if p != partitionLog {
+				return fmt.Errorf("datastore is partitioned by %s", p)
+			}
+			return nil
+		}
+		if k, _ := tx.Bucket([]byte("logs")).Cursor().First(); k != nil {
+			return fmt.Errorf("datastore is not empty. use twsla db compact --partition %s", partitionLog)
+		}
+		return setMeta(tx, "partition", partitionLog)
+	})
+}
+
+type logKV struct {
+	Key []byte
+	Log []byte
+}
+
+var zstdEnc *zstd.Encoder
+var zstdDec *zstd.Decoder
+var zstdOnce sync.Once
+
+func setupZstd() {
+	zstdOnce.Do(func() {
+		zstdEnc, _ = zstd.NewWriter(nil)
+		zstdDec, _ = zstd.NewReader(nil)
+	})
+}
+
+func encodeBlock(logs []logKV) []byte {
+	setupZstd()
+	buf := []byte{}
+	for _, l := range logs {
+		buf = binary.AppendUvarint(buf, uint64(len(l.Key)))
+		buf = append(buf, l.Key...)
+		buf = binary.AppendUvarint(buf, uint64(len(l.Log)))
+		buf = append(buf, l.Log...)
+	}
+	return zstdEnc.EncodeAll(buf, nil)
+}
+
+func decodeBlock(v []byte) ([]logKV, error) {
+	setupZstd()
+	buf, err := zstdDec.DecodeAll(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	r := []logKV{}
+	for len(buf) > 0 {
+		var e logKV
+		for _, p := range []*[]byte{&e.Key, &e.Log} {
+			n, i := binary.Uvarint(buf)
+			if i <= 0 || uint64(len(buf)-i) < n {
+				return nil, fmt.Errorf("invalid log block")
+			}
+			*p = buf[i : i+int(n)]
+			buf = buf[i+int(n):]
+		}
+		r = append(r, e)
+	}
+	return r, nil
+}
+
+// logStore : read and write logs bucket for any datastore format
+type logStore struct {
+	root       *bbolt.Bucket
+	b          *bbolt.Bucket
+	part       int64
+	partKey    []byte
+	compressed bool
+	cacheKey   []byte
+	cache      []logKV
+}
+
+func newLogStore(tx *bbolt.Tx) *logStore {
+	s := &logStore{
+		root:       tx.Bucket([]byte("logs")),
+		compressed: isCompressed(tx),
+	}
+	s.part, _ = getPartitionSize(getMeta(tx, "partition"))
+	return s
+}
+
+// partitionKey : get key of partition bucket that has log key
+func (s *logStore) partitionKey(k []byte) []byte {
+	t, err := strconv.ParseInt(string(k[:min(16, len(k))]), 16, 64)
+	if err != nil || t < 0 {
+		t = 0
+	}
+	return []byte(fmt.Sprintf("%016x", t-t%s.part))
+}
+
+// bucket : get bucket that has log key
+func (s *logStore) bucket(k []byte) *bbolt.Bucket {
+	if s.part == 0 {
+		return s.root
+	}
+	pk := s.partitionKey(k)
+	if s.b == nil || !bytes.Equal(pk, s.partKey) {
+		s.b = s.root.Bucket(pk)
+		s.partKey = pk
+	}
+	return s.b
+}
+
+// createBucket : get bucket that has log key and create partition if needed
+func (s *logStore) createBucket(k []byte) (*bbolt.Bucket, error) {
+	if b := s.bucket(k); b != nil {
+		return b, nil
+	}
+	b, err := s.root.CreateBucket(s.partKey)
+	if err != nil {
+		return nil, err
+	}
+	s.b = b
+	return b, nil
+}
+
+// partitionLen : get number of logs at the head in the same partition
+func (s *logStore) partitionLen(logs []logKV) int {
+	if s.part == 0 {
+		return len(logs)
+	}
+	pk := s.partitionKey(logs[0].Key)
+	for i := 1; i < len(logs); i++ {
+		if !bytes.Equal(s.partitionKey(logs[i].Key), pk) {
+			return i
+		}
+	}
+	return len(logs)
+}
+
+// getBlock : decode block. Broken block is an error not to overwrite it by put.
+func (s *logStore) getBlock(k, v []byte) ([]logKV, error) {
+	if s.cacheKey != nil && bytes.Equal(k, s.cacheKey) {
+		return s.cache, nil
+	}
+	logs, err := decodeBlock(v)
+	if err != nil {
+		return nil, fmt.Errorf("block %s: %w", k, err)
+	}
+	s.cacheKey = append(s.cacheKey[:0], k...)
+	s.cache = logs
+	return logs, nil
+}
+
+// seekBlock : move cursor to the block that may have key
+func seekBlock(c *bbolt.Cursor, key []byte) ([]byte, []byte) {
+	k, v := c.Seek(key)
+	if k == nil {
+		return c.Last()
+	}
+	if !bytes.Equal(k, key) {
+		if pk, pv := c.Prev(); pk != nil {
+			return pk, pv
+		}
+		return c.First()
+	}
+	return k, v
+}
+
+// get : get log by key
+func (s *logStore) get(key []byte) ([]byte, error) {
+	b := s.bucket(key)
+	if b == nil {
+		return nil, nil
+	}
+	if !s.compressed {
+		return b.Get(key), nil
+	}
+	k, v := seekBlock(b.Cursor(), key)
+	if k == nil {
+		return nil, nil
+	}
+	logs, err := s.getBlock(k, v)
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(logs), func(i int) bool { return bytes.Compare(logs[i].Key, key) >= 0 })
+	if i < len(logs) && bytes.Equal(logs[i].Key, key) {
+		return logs[i].Log, nil
+	}
+	return nil, nil
+}
+
+// seek : call fn for each log from key sk.
+// Partitions before sk are skipped.
+func (s *logStore) seek(sk []byte, fn func(k, v []byte) bool) error {
+	if s.root == nil {
+		return nil
+	}
+	if s.part == 0 {
+		_, err := s.seekBucket(s.root, sk, fn)
+		return err
+	}
+	c := s.root.Cursor()
+	for pk, v := c.Seek(s.partitionKey(sk)); pk != nil; pk, v = c.Next() {
+		if v != nil {
+			continue
+		}
+		if ok, err := s.seekBucket(s.root.Bucket(pk), sk, fn); !ok || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *logStore) seekBucket(b *bbolt.Bucket, sk []byte, fn func(k, v []byte) bool) (bool, error) {
+	c := b.Cursor()
+	if !s.compressed {
+		for k, v := c.Seek(sk); k != nil; k, v = c.Next() {
+			if !fn(k, v) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	for k, v := seekBlock(c, sk); k != nil; k, v = c.Next() {
+		logs, err := s.getBlock(k, v)
+		if err != nil {
+			return false, err
+		}
+		for _, l := range logs {
+			if bytes.Compare(l.Key, sk) < 0 {
+				continue
+			}
+			if !fn(l.Key, l.Log) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// put : save logs sorted by key
+func (s *logStore) put(logs []logKV) error {
+	for len(logs) > 0 {
+		n := s.partitionLen(logs)
+		b, err := s.createBucket(logs[0].Key)
+		if err != nil {
+			return err
+		}
+		if err := s.putBucket(b, logs[:n]); err != nil {
+			return err
+		}
+		logs = logs[n:]
+	}
+	return nil
+}
+
+func (s *logStore) putBucket(b *bbolt.Bucket, logs []logKV) error {
+	if !s.compressed {
+		for _, l := range logs {
+			if err := b.Put(l.Key, l.Log); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for len(logs) > 0 {
+		c := b.Cursor()
+		k, v := seekBlock(c, logs[0].Key)
+		block := []logKV{}
+		var nk []byte
+		if k != nil {
+			var err error
+			if block, err = s.getBlock(k, v); err != nil {
+				return err
+			}
+			k = append([]byte{}, k...)
+			nk, _ = c.Next()
+		}
+		n := len(logs)
+		if nk != nil {
+			n = sort.Search(len(logs), func(i int) bool { return bytes.Compare(logs[i].Key, nk) >= 0 })
+		}
+		block = mergeLogs(block, logs[:n])
+		logs = logs[n:]
+		s.cacheKey = nil
+		if k != nil {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		nb := (len(block) + maxBlockLogs - 1) / maxBlockLogs
+		for i := 0; i < nb; i++ {
+			sb := block[len(block)*i/nb : len(block)*(i+1)/nb]
+			if err := b.Put(append([]byte{}, sb[0].Key...), encodeBlock(sb)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// delete : delete logs sorted by key.
+// Empty partitions are deleted.
+func (s *logStore) delete(logs []logKV) error {
+	for len(logs) > 0 {
+		n := s.partitionLen(logs)
+		b := s.bucket(logs[0].Key)
+		if b != nil {
+			if err := s.deleteBucket(b, logs[:n]); err != nil {
+				return err
+			}
+			if k, _ := b.Cursor().First(); k == nil && s.part > 0 {
+				if err := s.root.DeleteBucket(s.partKey); err != nil {
+					return err
+				}
+				s.b = nil
+			}
+		}
+		logs = logs[n:]
+	}
+	return nil
+}
+
+func (s *logStore) deleteBucket(b *bbolt.Bucket, logs []logKV) error {
+	if !s.compressed {
+		for _, l := range logs {
+			if err := b.Delete(l.Key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for len(logs) > 0 {
+		c := b.Cursor()
+		k, v := seekBlock(c, logs[0].Key)
+		if k == nil {
+			return nil
+		}
+		block, err := s.getBlock(k, v)
+		if err != nil {
+			return err
+		}
+		k = append([]byte{}, k...)
+		n := len(logs)
+		if nk, _ := c.Next(); nk != nil {
+			n = sort.Search(len(logs), func(i int) bool { return bytes.Compare(logs[i].Key, nk) >= 0 })
+		}
+		del := make(map[string]bool)
+		for _, l := range logs[:n] {
+			del[string(l.Key)] = true
+		}
+		logs = logs[n:]
+		nb := []logKV{}
+		for _, l := range block {
+			if !del[string(l.Key)] {
+				nb = append(nb, l)
+			}
+		}
+		if len(nb) == len(block) {
+			continue
+		}
+		s.cacheKey = nil
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+		if len(nb) > 0 {
+			if err := b.Put(append([]byte{}, nb[0].Key...), encodeBlock(nb)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteLogs : delete logs sorted by key with delta and index
+func deleteLogs(tx *bbolt.Tx, logs []logKV) error {
+	indexed := isIndexed(tx)
+	fields := getMeta(tx, "fields")
+	bd := tx.Bucket([]byte("delta"))
+	for _, l := range logs {
+		if bd != nil {
+			if err := bd.Delete(l.Key); err != nil {
+				return err
+			}
+		}
+		if indexed {
+			if err := delIndex(tx, l.Key, string(l.Log)); err != nil {
+				return err
+			}
+		}
+		if fields != "" {
+			if err := delFields(tx, l.Key, string(l.Log), fields); err != nil {
+				return err
+			}
+		}
+	}
+	return newLogStore(tx).delete(logs)
+}
+
+// mergeLogs : merge sorted logs. same key is replaced by new log.
+func mergeLogs(a, b []logKV) []logKV {
+	r := make([]logKV, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch bytes.Compare(a[i].Key, b[j].Key) {
+		case -1:
+			r = append(r, a[i])
+			i++
+		case 0:
+			i++
+		default:
+			r = append(r, b[j])
+			j++
+		}
+	}
+	r = append(r, a[i:]...)
+	return append(r, b[j:]...)
+}
+
+// scanLogs : call fn for each log in time range.
+// Use token index to skip logs that never match simple filters.
+// Error is broken block of compressed datastore.
+func scanLogs(tx *bbolt.Tx, sti, eti int64, fn func(t int64, k, v []byte) bool) error {
+	s := newLogStore(tx)
+	ids, err := getSourceIDFilter(tx)
+	if err != nil {
+		return err
+	}
+	if ids != nil {
+		f := fn
+		fn = func(t int64, k, v []byte) bool {
+			if !ids[getSourceID(k)] {
+				return true
+			}
+			return f(t, k, v)
+		}
+	}
+	if keys, ok := getIndexCandidates(tx, sti, eti); ok {
+		for _, k := range keys {
+			v, err := s.get([]byte(k))
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			t, _ := strconv.ParseInt(k[:16], 16, 64)
+			if !fn(t, []byte(k), v) {
+				return nil
+			}
+		}
+		return nil
+	}
+	sk := fmt.Sprintf("%016x:", sti)
+	return s.seek([]byte(sk), func(k, v []byte) bool {
+		a := strings.Split(string(k), ":")
+		if len(a) < 1 {
+			return true
+		}
+		t, err := strconv.ParseInt(a[0], 16, 64)
+		if err == nil && t > eti {
+			return false
+		}
+		return fn(t, k, v)
+	})
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestCompressedLogStore(t *testing.T) {
+	var err error
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err = openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = setupCompress(); err != nil {
+		t.Fatal(err)
+	}
+	// Save logs out of order to split and merge blocks.
+	for _, r := range [][]int{{1000, 2500}, {0, 1000}, {2500, 3000}, {500, 600}} {
+		logs := []logBufEnt{}
+		for i := r[0]; i < r[1]; i++ {
+			logs = append(logs, logBufEnt{
+				ID:  []byte(fmt.Sprintf("%016x:00:%x", i, i)),
+				Log: []byte(fmt.Sprintf("log %d", i)),
+			})
+		}
+		if err = saveLogs(logs, getDataStoreInfo()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		n := 0
+		scanLogs(tx, 100, 2899, func(ti int64, k, v []byte) bool {
+			if want := fmt.Sprintf("log %d", ti); string(v) != want {
+				t.Errorf("scanLogs got %s, want %s", v, want)
+			}
+			if ti != int64(n+100) {
+				t.Errorf("scanLogs time got %d, want %d", ti, n+100)
+			}
+			n++
+			return true
+		})
+		if n != 2800 {
+			t.Errorf("scanLogs count got %d, want 2800", n)
+		}
+		s := newLogStore(tx)
+		if v, _ := s.get([]byte(fmt.Sprintf("%016x:00:%x", 1234, 1234))); string(v) != "log 1234" {
+			t.Errorf("get got %s", v)
+		}
+		if v, _ := s.get([]byte("0000000000000001:00:2")); v != nil {
+			t.Errorf("get not found got %s", v)
+		}
+		return nil
+	})
+	dst, err := bbolt.Open(filepath.Join(t.TempDir(), "compact.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	batchSize = 700
+	if n, err := compactDB(dst, db); err != nil || n != 3000 {
+		t.Errorf("compactDB got %d %v", n, err)
+	}
+}
+
+func TestBrokenBlock(t *testing.T) {
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := setupCompress(); err != nil {
+		t.Fatal(err)
+	}
+	broken := []byte("broken block")
+	db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("logs")).Put([]byte("0000000000000001:00:1"), broken)
+	})
+	logs := []logBufEnt{{ID: []byte("0000000000000002:00:2"), Log: []byte("log 2")}}
+	if err := saveLogs(logs, getDataStoreInfo()); err == nil {
+		t.Error("save to broken block got no error")
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket([]byte("logs")).Get([]byte("0000000000000001:00:1")); string(v) != string(broken) {
+			t.Errorf("broken block is overwritten %q", v)
+		}
+		if err := scanLogs(tx, 0, 1<<62, func(ti int64, k, v []byte) bool { return true }); err == nil {
+			t.Error("scan broken block got no error")
+		}
+		return nil
+	})
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		return newLogStore(tx).delete([]logKV{{Key: []byte("0000000000000001:00:1")}})
+	}); err == nil {
+		t.Error("delete in broken block got no error")
+	}
+	defer func() {
+		scanWorkers = 0
+	}()
+	timeRange = ""
+	sourceFilter = ""
+	setupFilter([]string{})
+	for _, n := range []int{1, 4} {
+		scanWorkers = n
+		_, _, err := scanLogsParallel(0, 1<<62, scanOpt{}, func(tx *bbolt.Tx) func(e *logEnt) (bool, bool) {
+			return func(e *logEnt) (bool, bool) { return true, true }
+		}, func(e *logEnt, r bool) bool { return true })
+		if err == nil {
+			t.Errorf("workers=%d scan broken block got no error", n)
+		}
+	}
+	if _, err := deleteLogsByFilter(0, 1<<62); err == nil {
+		t.Error("delete by filter in broken block got no error")
+	}
+}
+
+func TestPartitionedLogStore(t *testing.T) {
+	defer func() {
+		partitionLog = ""
+	}()
+	for _, compressed := range []bool{false, true} {
+		dataStore = filepath.Join(t.TempDir(), "twsla.db")
+		if err := openDB(); err != nil {
+			t.Fatal(err)
+		}
+		if compressed {
+			if err := setupCompress(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		partitionLog = "hour"
+		if err := setupPartition(); err != nil {
+			t.Fatal(err)
+		}
+		step := int64(7 * time.Minute)
+		key := func(i int) []byte {
+			return []byte(fmt.Sprintf("%016x:00:%x", int64(i)*step, i))
+		}
+		// Save logs out of order over many partitions.
+		for _, r := range [][]int{{300, 500}, {0, 100}, {100, 300}, {50, 60}} {
+			logs := []logBufEnt{}
+			for i := r[1] - 1; i >= r[0]; i-- {
+				logs = append(logs, logBufEnt{ID: key(i), Log: []byte(fmt.Sprintf("log %d", i))})
+			}
+			if err := saveLogs(logs, getDataStoreInfo()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		partitions := 0
+		db.View(func(tx *bbolt.Tx) error {
+			tx.Bucket([]byte("logs")).ForEachBucket(func(k []byte) error {
+				partitions++
+				return nil
+			})
+			n := 0
+			scanLogs(tx, 100*step, 399*step, func(ti int64, k, v []byte) bool {
+				if want := fmt.Sprintf("log %d", n+100); string(v) != want {
+					t.Errorf("scanLogs got %s, want %s", v, want)
+				}
+				n++
+				return true
+			})
+			if n != 300 {
+				t.Errorf("scanLogs count got %d, want 300", n)
+			}
+			if v, _ := newLogStore(tx).get(key(123)); string(v) != "log 123" {
+				t.Errorf("get got %s", v)
+			}
+			return nil
+		})
+		if want := int(499*step/int64(time.Hour)) + 1; partitions != want {
+			t.Errorf("partitions got %d, want %d", partitions, want)
+		}
+		// Delete logs of first hour and check empty partition is deleted.
+		if n, err := deleteLogsByFilter(0, int64(time.Hour)-1); err != nil || n != 9 {
+			t.Errorf("deleteLogsByFilter got %d %v", n, err)
+		}
+		db.View(func(tx *bbolt.Tx) error {
+			if tx.Bucket([]byte("logs")).Bucket([]byte(fmt.Sprintf("%016x", 0))) != nil {
+				t.Error("empty partition is not deleted")
+			}
+			return nil
+		})
+		partitionLog = "day"
+		if err := setupPartition(); err == nil {
+			t.Error("setupPartition with another partition got no error")
+		}
+		db.Close()
+	}
+}
+
+func TestOpenDBReadOnly(t *testing.T) {
+	defer func() {
+		snapshotInterval = 0
+	}()
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err := openDBReadOnly(); err == nil {
+		t.Fatal("openDBReadOnly of no datastore got no error")
+	}
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	logs := []logBufEnt{}
+	for i := 0; i < 100; i++ {
+		logs = append(logs, logBufEnt{ID: []byte(fmt.Sprintf("%016x:00:%x", i, i)), Log: []byte("log")})
+	}
+	if err := saveLogs(logs, getDataStoreInfo()); err != nil {
+		t.Fatal(err)
+	}
+	snapshotInterval = 60
+	if err := writeSnapshot(true); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		n := 0
+		db.View(func(tx *bbolt.Tx) error {
+			newLogStore(tx).seek([]byte{}, func(k, v []byte) bool {
+				n++
+				return true
+			})
+			return nil
+		})
+		return n
+	}
+	// Datastore is locked by writer, so snapshot is used.
+	w := db
+	if err := openDBReadOnly(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Path() != getSnapshotPath() || count() != 100 {
+		t.Errorf("snapshot got %s %d", db.Path(), count())
+	}
+	db.Close()
+	db = w
+	removeSnapshot()
+	db.Close()
+	if err := openDBReadOnly(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Path() != dataStore || count() != 100 {
+		t.Errorf("read only got %s %d", db.Path(), count())
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		return setMeta(tx, "test", "test")
+	}); err == nil {
+		t.Error("update of read only datastore got no error")
+	}
+}
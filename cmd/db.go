@@ -0,0 +1,509 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/xhit/go-str2duration/v2"
+	"go.etcd.io/bbolt"
+)
+
+// dbCmd represents the db command
+var dbCmd = &cobra.Command{
+	Use:   "db [compact|stats|prune|delete|vacuum|merge|split]",
+	Short: "Manage datastore",
+	Long: `Manage datastore.
+compact : Convert datastore to compressed format and reclaim free space.
+ $twsla db compact -d twsla.db
+ $twsla db compact --partition day
+stats : Show number of logs, time span, logs per source and per day, bucket sizes.
+ $twsla db stats
+prune : Delete logs before specified time.
+ $twsla db prune --before 2024/01/01
+ $twsla db prune --before 90d
+delete : Delete logs matching time range, filter and source.
+ $twsla db delete -t 2024/05/01,1h -f sshd
+vacuum : Rewrite datastore to reclaim free space.
+ $twsla db vacuum
+merge : Merge datastores into datastore.
+ $twsla db merge a.db b.db -d out.db
+split : Copy logs matching time range, filter and source to new datastore.
+ $twsla db split -t 2024/05/01,1d -f sshd -o sshd.db
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		switch args[0] {
+		case "compact", "stats", "vacuum":
+		case "merge":
+			if len(args) < 2 {
+				return fmt.Errorf("merge needs datastores to merge")
+			}
+		case "split":
+			if splitOut == "" {
+				return fmt.Errorf("split needs --out")
+			}
+		case "prune":
+			if pruneBefore == "" {
+				return fmt.Errorf("prune needs --before")
+			}
+		case "delete":
+			if timeRange == "" && simpleFilter == "" && regexpFilter == "" && notFilter == "" && sourceFilter == "" && len(args) < 2 {
+				return fmt.Errorf("delete needs time range, filter or source")
+			}
+		default:
+			return fmt.Errorf("invalid subcommand specified: %s", args[0])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "compact":
+			dbCompactMain()
+		case "stats":
+			dbStatsMain()
+		case "prune":
+			dbPruneMain()
+		case "delete":
+			setupFilter(args[1:])
+			dbDeleteMain()
+		case "vacuum":
+			dbVacuumMain()
+		case "merge":
+			dbMergeMain(args[1:])
+		case "split":
+			setupFilter(args[1:])
+			dbSplitMain()
+		}
+	},
+}
+
+var pruneBefore string
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.Flags().IntVarP(&batchSize, "size", "b", 10000, "Batch Size")
+	dbCmd.Flags().StringVar(&pruneBefore, "before", "", "Delete logs before this time or duration")
+	dbCmd.Flags().StringVar(&sourceFilter, "source", "", "Source path filter")
+	dbCmd.Flags().BoolVar(&jsonOut, "jsonOut", false, "output json format")
+	dbCmd.Flags().StringVarP(&splitOut, "out", "o", "", "Output datastore of split")
+	dbCmd.Flags().StringVar(&partitionLog, "partition", "", "Partition logs by day or hour on compact")
+}
+
+func dbCompactMain() {
+	st = time.Now()
+	n, ss := rewriteDataStore(compactDB)
+	fmt.Printf("compact %s logs=%s size=%s -> %s time=%v\n",
+		dataStore,
+		humanize.Comma(int64(n)),
+		humanize.Bytes(uint64(ss)),
+		humanize.Bytes(uint64(getFileSize(dataStore))),
+		time.Since(st))
+}
+
+func dbVacuumMain() {
+	st = time.Now()
+	_, ss := rewriteDataStore(func(dst, src *bbolt.DB) (int, error) {
+		return 0, copyDB(dst, src, nil)
+	})
+	fmt.Printf("vacuum %s size=%s -> %s time=%v\n",
+		dataStore,
+		humanize.Bytes(uint64(ss)),
+		humanize.Bytes(uint64(getFileSize(dataStore))),
+		time.Since(st))
+}
+
+// rewriteDataStore : rewrite datastore to new file and replace it
+func rewriteDataStore(fn func(dst, src *bbolt.DB) (int, error)) (int, int64) {
+	if err := openDB(); err != nil {
+		log.Fatalln(err)
+	}
+	tmp := dataStore + ".tmp"
+	os.Remove(tmp)
+	dst, err := bbolt.Open(tmp, 0600, &bbolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	n, err := fn(dst, db)
+	dst.Close()
+	db.Close()
+	if err != nil {
+		os.Remove(tmp)
+		log.Fatalln(err)
+	}
+	ss := getFileSize(dataStore)
+	if err := os.Rename(tmp, dataStore); err != nil {
+		log.Fatalln(err)
+	}
+	return n, ss
+}
+
+type dbBucketStats struct {
+	Name string
+	Keys int
+	Size int
+}
+
+type dbSourceStats struct {
+	ID    string
+	Path  string
+	Count int
+}
+
+type dbDayStats struct {
+	Day   string
+	Count int
+}
+
+type dbStatsEnt struct {
+	DataStore  string
+	Size       int64
+	Compressed bool
+	Indexed    bool
+	Partition  string
+	Partitions int
+	Profile    string
+	Logs       int
+	First      int64
+	Last       int64
+	Buckets    []dbBucketStats
+	Sources    []dbSourceStats
+	Days       []dbDayStats
+}
+
+func dbStatsMain() {
+	if err := openDBReadOnly(); err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	r := getDBStats()
+	if jsonOut {
+		j, err := json.Marshal(r)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(string(j))
+		return
+	}
+	fmt.Printf("DataStore\t%s\n", r.DataStore)
+	fmt.Printf("Size\t%s\n", humanize.Bytes(uint64(r.Size)))
+	fmt.Printf("Compressed\t%v\n", r.Compressed)
+	fmt.Printf("Indexed\t%v\n", r.Indexed)
+	if r.Partition != "" {
+		fmt.Printf("Partition\t%s\t%s\n", r.Partition, humanize.Comma(int64(r.Partitions)))
+	}
+	if r.Profile != "" {
+		fmt.Printf("Profile\t%s\n", r.Profile)
+	}
+	fmt.Printf("Logs\t%s\n", humanize.Comma(int64(r.Logs)))
+	if r.Logs > 0 {
+		fmt.Printf("First\t%s\n", time.Unix(0, r.First).Format(time.RFC3339Nano))
+		fmt.Printf("Last\t%s\n", time.Unix(0, r.Last).Format(time.RFC3339Nano))
+		fmt.Printf("Span\t%v\n", time.Duration(r.Last-r.First))
+	}
+	for _, b := range r.Buckets {
+		fmt.Printf("Bucket\t%s\t%s\t%s\n", b.Name, humanize.Comma(int64(b.Keys)), humanize.Bytes(uint64(b.Size)))
+	}
+	for _, s := range r.Sources {
+		fmt.Printf("Source\t%s\t%s\t%s\n", s.ID, s.Path, humanize.Comma(int64(s.Count)))
+	}
+	for _, d := range r.Days {
+		fmt.Printf("Day\t%s\t%s\n", d.Day, humanize.Comma(int64(d.Count)))
+	}
+}
+
+// getDBStats : get statistics of datastore
+func getDBStats() *dbStatsEnt {
+	r := &dbStatsEnt{
+		DataStore: dataStore,
+		Size:      getFileSize(dataStore),
+	}
+	paths := make(map[string]string)
+	for _, s := range getSources() {
+		paths[s.ID] = s.Path
+	}
+	sources := make(map[string]int)
+	days := make(map[string]int)
+	db.View(func(tx *bbolt.Tx) error {
+		r.Compressed = isCompressed(tx)
+		r.Indexed = isIndexed(tx)
+		r.Profile = getMeta(tx, "profile")
+		if r.Partition = getMeta(tx, "partition"); r.Partition != "" {
+			tx.Bucket([]byte("logs")).ForEachBucket(func(k []byte) error {
+				r.Partitions++
+				return nil
+			})
+		}
+		tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			bs := b.Stats()
+			r.Buckets = append(r.Buckets, dbBucketStats{
+				Name: string(name),
+				Keys: bs.KeyN,
+				Size: bs.BranchInuse + bs.LeafInuse + bs.InlineBucketInuse,
+			})
+			return nil
+		})
+		return newLogStore(tx).seek([]byte{}, func(k, v []byte) bool {
+			t, err := strconv.ParseInt(string(k[:min(16, len(k))]), 16, 64)
+			if err != nil {
+				return true
+			}
+			if r.Logs == 0 {
+				r.First = t
+			}
+			r.Last = t
+			r.Logs++
+			sources[getSourceID(k)]++
+			ts := time.Unix(0, t)
+			if utc {
+				ts = ts.UTC()
+			}
+			days[ts.Format("2006-01-02")]++
+			return true
+		})
+	})
+	for id, c := range sources {
+		r.Sources = append(r.Sources, dbSourceStats{ID: id, Path: paths[id], Count: c})
+	}
+	sort.Slice(r.Sources, func(i, j int) bool {
+		return r.Sources[i].Count > r.Sources[j].Count
+	})
+	for d, c := range days {
+		r.Days = append(r.Days, dbDayStats{Day: d, Count: c})
+	}
+	sort.Slice(r.Days, func(i, j int) bool {
+		return r.Days[i].Day < r.Days[j].Day
+	})
+	return r
+}
+
+func dbPruneMain() {
+	st = time.Now()
+	bt, err := getBeforeTime(pruneBefore)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := openDB(); err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	n, err := deleteLogsByFilter(0, bt-1)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("prune %s before=%s logs=%s time=%v\n",
+		dataStore,
+		time.Unix(0, bt).Format(time.RFC3339),
+		humanize.Comma(int64(n)),
+		time.Since(st))
+}
+
+func dbDeleteMain() {
+	st = time.Now()
+	if err := openDB(); err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	sti, eti := getTimeRange()
+	n, err := deleteLogsByFilter(sti, eti)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("delete %s logs=%s time=%v\n",
+		dataStore,
+		humanize.Comma(int64(n)),
+		time.Since(st))
+}
+
+// getBeforeTime : parse time or duration before now
+func getBeforeTime(s string) (int64, error) {
+	if d, err := str2duration.ParseDuration(s); err == nil {
+		return time.Now().Add(-d).UnixNano(), nil
+	}
+	t, err := dateparse.ParseLocal(strings.ReplaceAll(s, "/", "-"))
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano(), nil
+}
+
+// deleteLogsByFilter : delete logs matching time range, filter and source
+func deleteLogsByFilter(sti, eti int64) (int, error) {
+	total := 0
+	var lk []byte
+	for {
+		logs := []logKV{}
+		more := false
+		if err := db.View(func(tx *bbolt.Tx) error {
+			return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
+				if lk != nil && bytes.Compare(k, lk) <= 0 {
+					return true
+				}
+				if len(logs) >= batchSize {
+					more = true
+					return false
+				}
+				lk = append(lk[:0], k...)
+				sti = t
+				l := string(v)
+				if !matchFilter(&l) {
+					return true
+				}
+				logs = append(logs, logKV{Key: append([]byte{}, k...), Log: append([]byte{}, v...)})
+				return true
+			})
+		}); err != nil {
+			return total, err
+		}
+		if len(logs) > 0 {
+			if err := db.Update(func(tx *bbolt.Tx) error {
+				return deleteLogs(tx, logs)
+			}); err != nil {
+				return total, err
+			}
+			total += len(logs)
+		}
+		if !more {
+			return total, nil
+		}
+	}
+}
+
+// compactDB : copy src to dst with compressed logs.
+// Partition of dst is changed when partition is specified.
+func compactDB(dst, src *bbolt.DB) (int, error) {
+	if _, err := getPartitionSize(partitionLog); err != nil {
+		return 0, err
+	}
+	if err := copyDB(dst, src, func(name []byte) bool {
+		return string(name) == "logs"
+	}); err != nil {
+		return 0, err
+	}
+	if err := dst.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte("logs")); err != nil {
+			return err
+		}
+		if partitionLog != "" {
+			if err := setMeta(tx, "partition", partitionLog); err != nil {
+				return err
+			}
+		}
+		return setMeta(tx, "format", formatBlock)
+	}); err != nil {
+		return 0, err
+	}
+	total := 0
+	logs := []logKV{}
+	save := func() error {
+		err := dst.Update(func(tx *bbolt.Tx) error {
+			return newLogStore(tx).put(logs)
+		})
+		total += len(logs)
+		logs = []logKV{}
+		return err
+	}
+	var err error
+	if serr := src.View(func(tx *bbolt.Tx) error {
+		return newLogStore(tx).seek([]byte{}, func(k, v []byte) bool {
+			logs = append(logs, logKV{Key: append([]byte{}, k...), Log: append([]byte{}, v...)})
+			if len(logs) >= batchSize {
+				if err = save(); err != nil {
+					return false
+				}
+			}
+			return true
+		})
+	}); serr != nil {
+		return total, serr
+	}
+	if err != nil {
+		return total, err
+	}
+	return total, save()
+}
+
+// copyDB : copy buckets from src to dst except skipped top level buckets
+func copyDB(dst, src *bbolt.DB, skip func(name []byte) bool) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+	n := 0
+	var walk func(sb *bbolt.Bucket, path [][]byte) error
+	walk = func(sb *bbolt.Bucket, path [][]byte) error {
+		return sb.ForEach(func(k, v []byte) error {
+			if n >= batchSize {
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+				if tx, err = dst.Begin(true); err != nil {
+					return err
+				}
+				n = 0
+			}
+			n++
+			b := tx.Bucket(path[0])
+			for _, p := range path[1:] {
+				b = b.Bucket(p)
+			}
+			if v != nil {
+				return b.Put(k, v)
+			}
+			if _, err := b.CreateBucketIfNotExists(k); err != nil {
+				return err
+			}
+			return walk(sb.Bucket(k), append(path, k))
+		})
+	}
+	if err := src.View(func(stx *bbolt.Tx) error {
+		return stx.ForEach(func(name []byte, sb *bbolt.Bucket) error {
+			if skip != nil && skip(name) {
+				return nil
+			}
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+			return walk(sb, [][]byte{append([]byte{}, name...)})
+		})
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getFileSize(path string) int64 {
+	if s, err := os.Stat(path); err == nil {
+		return s.Size()
+	}
+	return 0
+}
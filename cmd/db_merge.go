@@ -0,0 +1,330 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"go.etcd.io/bbolt"
+)
+
+var splitOut string
+
+func dbMergeMain(inputs []string) {
+	st = time.Now()
+	if err := openDB(); err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	total := 0
+	for _, in := range inputs {
+		if sameFile(in, dataStore) {
+			log.Fatalf("can not merge %s into itself", in)
+		}
+		src, err := openSrcDB(in)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		n, err := mergeDB(src, in)
+		src.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("merge %s -> %s logs=%s\n", in, dataStore, humanize.Comma(int64(n)))
+		total += n
+	}
+	fmt.Printf("merge %s logs=%s time=%v\n", dataStore, humanize.Comma(int64(total)), time.Since(st))
+}
+
+func dbSplitMain() {
+	st = time.Now()
+	if _, err := os.Stat(splitOut); err == nil {
+		log.Fatalf("%s already exists", splitOut)
+	}
+	src, err := openSrcDB(dataStore)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer src.Close()
+	dataStore = splitOut
+	if err := openDB(); err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	n, err := splitDB(src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("split %s logs=%s time=%v\n", splitOut, humanize.Comma(int64(n)), time.Since(st))
+}
+
+func openSrcDB(path string) (*bbolt.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return bbolt.Open(path, 0600, &bbolt.Options{Timeout: 3 * time.Second, ReadOnly: true})
+}
+
+func sameFile(a, b string) bool {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(sa, sb)
+}
+
+// inheritFormat : use same format as src when datastore is empty
+func inheritFormat(src *bbolt.DB) error {
+	var info dataStoreInfo
+	var pat, def, profile string
+	var idLen int
+	src.View(func(tx *bbolt.Tx) error {
+		info.Compressed = isCompressed(tx)
+		info.Indexed = isIndexed(tx)
+		info.Fields = getMeta(tx, "fields")
+		info.Partition = getMeta(tx, "partition")
+		pat = getMeta(tx, "fieldsGrokPat")
+		def = getMeta(tx, "fieldsGrokDef")
+		profile = getMeta(tx, "profile")
+		idLen = getSourceIDLen(tx)
+		return nil
+	})
+	empty := false
+	db.View(func(tx *bbolt.Tx) error {
+		k, _ := tx.Bucket([]byte("logs")).Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	if !empty {
+		return setupFields()
+	}
+	if info.Compressed {
+		if err := setupCompress(); err != nil {
+			return err
+		}
+	}
+	if info.Partition != "" {
+		partitionLog = info.Partition
+		if err := setupPartition(); err != nil {
+			return err
+		}
+	}
+	if info.Indexed {
+		if err := setupIndex(); err != nil {
+			return err
+		}
+	}
+	if profile != "" {
+		if err := db.Update(func(tx *bbolt.Tx) error {
+			return setMeta(tx, "profile", profile)
+		}); err != nil {
+			return err
+		}
+	}
+	// Import to merged datastore uses the same source ID as src
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		sourceIDLen = idLen
+		return setMeta(tx, "sourceID", strconv.Itoa(idLen))
+	}); err != nil {
+		return err
+	}
+	fieldsMode = info.Fields
+	grokPat = pat
+	grokDef = def
+	return setupFields()
+}
+
+// mergeDB : merge logs, delta and sources of src into datastore.
+// The source ID of src is changed when datastore has the same ID of another source.
+func mergeDB(src *bbolt.DB, name string) (int, error) {
+	if err := inheritFormat(src); err != nil {
+		return 0, err
+	}
+	ids := getDataStoreIDs(db)
+	srcIDs := getDataStoreIDs(src)
+	var dstSources, srcSources map[string]*sourceEnt
+	db.View(func(tx *bbolt.Tx) error {
+		dstSources = getSourceMap(tx)
+		return nil
+	})
+	src.View(func(tx *bbolt.Tx) error {
+		srcSources = getSourceMap(tx)
+		return nil
+	})
+	idMap := make(map[string]string)
+	base := filepath.Base(name)
+	for id := range srcIDs {
+		nid := id
+		if ids[id] && !isSameSource(dstSources[id], srcSources[id]) {
+			for i := 0; ids[nid] || srcIDs[nid]; i++ {
+				nid = getSHA1(fmt.Sprintf("%s:%s:%d", base, id, i))
+			}
+		}
+		idMap[id] = nid
+		ids[nid] = true
+	}
+	n, err := copyLogs(src, 0, math.MaxInt64, false, func(k []byte) []byte {
+		a := strings.SplitN(string(k), ":", 3)
+		if len(a) != 3 || idMap[a[1]] == a[1] {
+			return k
+		}
+		return []byte(a[0] + ":" + idMap[a[1]] + ":" + a[2])
+	})
+	if err != nil {
+		return n, err
+	}
+	for id, s := range srcSources {
+		nid, ok := idMap[id]
+		if !ok {
+			continue
+		}
+		if d, ok := dstSources[nid]; ok && d.Offset > s.Offset {
+			continue
+		}
+		s.ID = nid
+		saveSource(s)
+	}
+	return n, nil
+}
+
+// splitDB : copy logs matching time range, filter and source from src to datastore
+func splitDB(src *bbolt.DB) (int, error) {
+	if err := inheritFormat(src); err != nil {
+		return 0, err
+	}
+	ids := make(map[string]bool)
+	sti, eti := getTimeRange()
+	n, err := copyLogs(src, sti, eti, true, func(k []byte) []byte {
+		ids[getSourceID(k)] = true
+		return k
+	})
+	if err != nil {
+		return n, err
+	}
+	var srcSources map[string]*sourceEnt
+	src.View(func(tx *bbolt.Tx) error {
+		srcSources = getSourceMap(tx)
+		return nil
+	})
+	for id, s := range srcSources {
+		if ids[id] {
+			saveSource(s)
+		}
+	}
+	return n, nil
+}
+
+// copyLogs : copy logs and delta from src to datastore with new key
+func copyLogs(src *bbolt.DB, sti, eti int64, filter bool, newKey func(k []byte) []byte) (int, error) {
+	info := getDataStoreInfo()
+	total := 0
+	logs := []logBufEnt{}
+	var err error
+	if serr := src.View(func(tx *bbolt.Tx) error {
+		bd := tx.Bucket([]byte("delta"))
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
+			if filter {
+				l := string(v)
+				if !matchFilter(&l) {
+					return true
+				}
+			}
+			e := logBufEnt{
+				ID:  append([]byte{}, newKey(k)...),
+				Log: append([]byte{}, v...),
+			}
+			if bd != nil {
+				if d := bd.Get(k); d != nil {
+					e.Delta = append([]byte{}, d...)
+				}
+			}
+			logs = append(logs, e)
+			if len(logs) >= batchSize {
+				if err = saveLogs(logs, info); err != nil {
+					return false
+				}
+				total += len(logs)
+				logs = []logBufEnt{}
+			}
+			return true
+		})
+	}); serr != nil {
+		return total, serr
+	}
+	if err != nil {
+		return total, err
+	}
+	if len(logs) > 0 {
+		if err = saveLogs(logs, info); err != nil {
+			return total, err
+		}
+		total += len(logs)
+	}
+	return total, nil
+}
+
+// getDataStoreIDs : get source IDs used in log keys
+func getDataStoreIDs(d *bbolt.DB) map[string]bool {
+	r := make(map[string]bool)
+	d.View(func(tx *bbolt.Tx) error {
+		return newLogStore(tx).seek([]byte{}, func(k, v []byte) bool {
+			r[getSourceID(k)] = true
+			return true
+		})
+	})
+	return r
+}
+
+// isSameSource : check logs with same ID are imported from same content
+func isSameSource(a, b *sourceEnt) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Fingerprint != "" {
+		return a.Fingerprint == b.Fingerprint && a.FPLen == b.FPLen
+	}
+	return b.Fingerprint == "" && a.ModTime != 0 &&
+		a.Path == b.Path && a.Size == b.Size && a.ModTime == b.ModTime
+}
+
+func getSourceMap(tx *bbolt.Tx) map[string]*sourceEnt {
+	r := make(map[string]*sourceEnt)
+	b := tx.Bucket([]byte("sources"))
+	if b == nil {
+		return r
+	}
+	b.ForEach(func(k, v []byte) error {
+		var s sourceEnt
+		if err := json.Unmarshal(v, &s); err == nil {
+			r[string(k)] = &s
+		}
+		return nil
+	})
+	return r
+}
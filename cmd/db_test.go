@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestDeleteLogsByFilter(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		var err error
+		dataStore = filepath.Join(t.TempDir(), "twsla.db")
+		if err = openDB(); err != nil {
+			t.Fatal(err)
+		}
+		batchSize = 300
+		if compressed {
+			if err = setupCompress(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = setupIndex(); err != nil {
+			t.Fatal(err)
+		}
+		logs := []logBufEnt{}
+		for i := 0; i < 3000; i++ {
+			kind := "even"
+			if i%2 == 1 {
+				kind = "odd"
+			}
+			logs = append(logs, logBufEnt{
+				ID:    []byte(fmt.Sprintf("%016x:00:%x", i, i)),
+				Log:   []byte(fmt.Sprintf("log %d %s", i, kind)),
+				Delta: []byte("1"),
+			})
+		}
+		if err = saveLogs(logs, getDataStoreInfo()); err != nil {
+			t.Fatal(err)
+		}
+		simpleFilter = ""
+		setupFilter([]string{})
+		if n, err := deleteLogsByFilter(1000, 1999); err != nil || n != 1000 {
+			t.Errorf("delete time range got %d %v compressed=%v", n, err, compressed)
+		}
+		simpleFilter = "odd"
+		setupFilter([]string{})
+		if n, err := deleteLogsByFilter(0, 999); err != nil || n != 500 {
+			t.Errorf("delete filter got %d %v compressed=%v", n, err, compressed)
+		}
+		simpleFilter = ""
+		setupFilter([]string{})
+		r := getDBStats()
+		if r.Logs != 1500 || r.First != 0 || r.Last != 2999 {
+			t.Errorf("stats got logs=%d first=%d last=%d compressed=%v", r.Logs, r.First, r.Last, compressed)
+		}
+		db.View(func(tx *bbolt.Tx) error {
+			if n := tx.Bucket([]byte("delta")).Stats().KeyN; n != 1500 {
+				t.Errorf("delta got %d compressed=%v", n, compressed)
+			}
+			simpleFilterList = []string{" odd"}
+			if keys, ok := getIndexCandidates(tx, 0, 3000); !ok || len(keys) != 500 {
+				t.Errorf("index got %d %v compressed=%v", len(keys), ok, compressed)
+			}
+			simpleFilterList = []string{}
+			return nil
+		})
+		db.Close()
+	}
+}
+
+func TestGetBeforeTime(t *testing.T) {
+	tests := []struct {
+		input string
+		ok    bool
+	}{
+		{"2024/01/01", true},
+		{"2024-01-01 10:00:00", true},
+		{"30d", true},
+		{"1h", true},
+		{"bad time", false},
+	}
+	for _, tt := range tests {
+		if _, err := getBeforeTime(tt.input); (err == nil) != tt.ok {
+			t.Errorf("getBeforeTime(%q) err=%v", tt.input, err)
+		}
+	}
+}
+
+func TestMergeAndSplitDB(t *testing.T) {
+	dir := t.TempDir()
+	create := func(name, fp string, logs []logBufEnt) string {
+		dataStore = filepath.Join(dir, name)
+		if err := openDB(); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := saveLogs(logs, getDataStoreInfo()); err != nil {
+			t.Fatal(err)
+		}
+		saveSource(&sourceEnt{ID: "00000001", Path: "/var/log/syslog", Fingerprint: fp, FPLen: 10})
+		return dataStore
+	}
+	a := create("a.db", "aaaa", []logBufEnt{
+		{ID: []byte("0000000000000001:00000001:1"), Log: []byte("host a log 1"), Delta: []byte("1")},
+		{ID: []byte("0000000000000002:00000001:2"), Log: []byte("host a log 2")},
+	})
+	b := create("b.db", "bbbb", []logBufEnt{
+		{ID: []byte("0000000000000001:00000001:1"), Log: []byte("host b log 1"), Delta: []byte("1")},
+		{ID: []byte("0000000000000003:00000001:2"), Log: []byte("host b log 2")},
+	})
+	dataStore = filepath.Join(dir, "out.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	batchSize = 1
+	for _, in := range []string{a, b, a} {
+		src, err := openSrcDB(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mergeDB(src, in); err != nil {
+			t.Fatal(err)
+		}
+		src.Close()
+	}
+	r := getDBStats()
+	if r.Logs != 4 || len(r.Sources) != 2 {
+		t.Errorf("merge got logs=%d sources=%d", r.Logs, len(r.Sources))
+	}
+	db.Close()
+	timeRange = ""
+	simpleFilter = "host b"
+	setupFilter([]string{})
+	defer func() {
+		simpleFilter = ""
+		setupFilter([]string{})
+	}()
+	src, err := openSrcDB(dataStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dataStore = filepath.Join(dir, "split.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n, err := splitDB(src); err != nil || n != 2 {
+		t.Errorf("split got %d %v", n, err)
+	}
+	if s := getSources(); len(s) != 1 || s[0].Fingerprint != "bbbb" {
+		t.Errorf("split sources got %v", s)
+	}
+}
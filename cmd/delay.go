@@ -65,7 +65,7 @@ type delayMsg struct {
 
 func delayMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -78,6 +78,7 @@ func delayMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type delayEnt struct {
@@ -100,39 +101,8 @@ func delaySub(wg *sync.WaitGroup) {
 			log.Fatalln(err)
 		}
 	}
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		bd := tx.Bucket([]byte("delta"))
-		c := bd.Cursor()
-		if posDelay > 0 {
-			c = b.Cursor()
-		}
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
-			var d float64
-			if posDelay < 1 {
-				d, err = strconv.ParseFloat(string(v), 64)
-				if err != nil {
-					continue
-				}
-				v = b.Get(k)
-				if v == nil {
-					continue
-				}
-			} else {
-				t2 := getTimestamp(v)
-				if t2 == 0 {
-					continue
-				}
-				d = float64(t2 - t)
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		proc := func(t int64, v []byte, d float64) bool {
 			l := string(v)
 			lines++
 			if matchFilter(&l) {
@@ -147,7 +117,40 @@ func delaySub(wg *sync.WaitGroup) {
 			if lines%100 == 0 {
 				teaProg.Send(delayMsg{Lines: lines, Hit: hit, Dur: time.Since(st)})
 			}
-			if stopSearch {
+			return !stopSearch
+		}
+		if posDelay > 0 {
+			return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
+				t2 := getTimestamp(tg, v)
+				if t2 == 0 {
+					return true
+				}
+				return proc(t, v, float64(t2-t))
+			})
+		}
+		ls := newLogStore(tx)
+		c := tx.Bucket([]byte("delta")).Cursor()
+		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
+			a := strings.Split(string(k), ":")
+			if len(a) < 1 {
+				continue
+			}
+			t, err := strconv.ParseInt(a[0], 16, 64)
+			if err == nil && t > eti {
+				break
+			}
+			d, err := strconv.ParseFloat(string(v), 64)
+			if err != nil {
+				continue
+			}
+			v, err = ls.get(k)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			if !proc(t, v, d) {
 				break
 			}
 		}
@@ -438,9 +441,14 @@ func saveDelayTSVFile(path string) {
 }
 
 func getTimeGrinder() (*timegrinder.TimeGrinder, error) {
-	var err error
+	return newTimeGrinder(false)
+}
+
+// newTimeGrinder : make time grinder with custom formats.
+// Time grinder is not safe for concurrent use, so each worker needs its own.
+func newTimeGrinder(leftMost bool) (*timegrinder.TimeGrinder, error) {
 	tg, err := timegrinder.New(timegrinder.Config{
-		EnableLeftMostSeed: false,
+		EnableLeftMostSeed: leftMost,
 	})
 	if err != nil {
 		return tg, err
@@ -467,7 +475,7 @@ func getTimeGrinder() (*timegrinder.TimeGrinder, error) {
 	return tg, nil
 }
 
-func getTimestamp(v []byte) int64 {
+func getTimestamp(tg *timegrinder.TimeGrinder, v []byte) int64 {
 	for i := 0; i <= posDelay; i++ {
 		_, e, ok := tg.Match(v)
 		if !ok {
@@ -25,7 +25,6 @@ import (
 	"os"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -47,6 +46,8 @@ import (
 // Count by
 var emailCountBy string
 var checkSPF = false
+var emailAttachmentFilter string
+var emailAttachmentRe *regexp.Regexp
 
 var emailSPFMap = make(map[string]string)
 
@@ -59,7 +60,9 @@ It provides subcommands to search for specific emails or count emails by various
 
 Examples:
   twsla email search -t "last 1h"
-  twsla email count --emailCountBy from -t "last 24h"`,
+  twsla email search --attachment "\.zip"
+  twsla email count --emailCountBy from -t "last 24h"
+  twsla email count --emailCountBy attachment.type`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		// Optionally run one of the validators provided by cobra
 		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
@@ -75,6 +78,12 @@ Examples:
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		setupFilter(args[1:])
+		if emailAttachmentFilter != "" {
+			var err error
+			if emailAttachmentRe, err = regexp.Compile(emailAttachmentFilter); err != nil {
+				log.Fatalln(err)
+			}
+		}
 		switch args[0] {
 		case "search":
 			emailSearchMain()
@@ -88,22 +97,24 @@ func init() {
 	rootCmd.AddCommand(emailCmd)
 	emailCmd.Flags().StringVar(&emailCountBy, "emailCountBy", "time", "Count by field")
 	emailCmd.Flags().BoolVar(&checkSPF, "checkSPF", false, "Check SPF")
+	emailCmd.Flags().StringVar(&emailAttachmentFilter, "attachment", "", "Filter by attachment name, type, size or SHA-256 (regex)")
 }
 
 type emailSearchDataEnt struct {
-	Time       string
-	From       string
-	To         string
-	Subject    string
-	RetrunPath string
-	SenderIP   string
-	Domain     string
-	SPF        string
-	SPFList    string
-	Relay      int
-	Delay      int
-	Msg        *mail.Message
-	Log        *string
+	Time        string
+	From        string
+	To          string
+	Subject     string
+	RetrunPath  string
+	SenderIP    string
+	Domain      string
+	SPF         string
+	SPFList     string
+	Relay       int
+	Delay       int
+	Attachments []emailAttachment
+	Msg         *mail.Message
+	Log         *string
 }
 
 var emailSearchList = []emailSearchDataEnt{}
@@ -117,9 +128,7 @@ type emailSearchMsg struct {
 
 func emailSearchMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
-		log.Fatalln(err)
-	}
+	openEmailDB()
 	defer db.Close()
 	loadEmailSPFMap()
 	teaProg = tea.NewProgram(initEmailSearchModel())
@@ -131,40 +140,32 @@ func emailSearchMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
-	saveEmailSPFMap()
+	if err := saveEmailSPFMap(); err != nil {
+		log.Printf("SPF cache is not saved: %v", err)
+	}
+	checkScanErr()
 }
 
 func emailSearchSub(wg *sync.WaitGroup) {
 	defer wg.Done()
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	i := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			i++
 			l := string(v)
 			email := getMailInfo(&l)
-			if matchFilter(&l) {
+			if email != nil && matchFilter(&l) && matchEmailAttachment(email) {
 				email.Time = time.Unix(0, t).Format("2006/01/02 15:04")
 				emailSearchList = append(emailSearchList, *email)
 
 			}
 			teaProg.Send(emailSearchMsg{Lines: i, Hit: len(emailSearchList), Dur: time.Since(st)})
 			if stopSearch {
-				break
+				return false
 			}
-		}
-		return nil
+			return true
+		})
 	})
 	teaProg.Send(emailSearchMsg{Done: true, Lines: i, Hit: hit, Dur: time.Since(st)})
 }
@@ -384,9 +385,7 @@ func (m emailSearchModel) headerView() string {
 // email count command
 func emailCountMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
-		log.Fatalln(err)
-	}
+	openEmailDB()
 	defer db.Close()
 	loadEmailSPFMap()
 	teaProg = tea.NewProgram(initCountModel())
@@ -398,7 +397,10 @@ func emailCountMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
-	saveEmailSPFMap()
+	if err := saveEmailSPFMap(); err != nil {
+		log.Printf("SPF cache is not saved: %v", err)
+	}
+	checkScanErr()
 }
 
 func emailCountSub(wg *sync.WaitGroup) {
@@ -406,7 +408,6 @@ func emailCountSub(wg *sync.WaitGroup) {
 	var countMap = make(map[string]int)
 	intv := int64(getInterval()) * 1000 * 1000 * 1000
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	i := 0
 	hit := 0
 	mode := 0
@@ -442,29 +443,28 @@ func emailCountSub(wg *sync.WaitGroup) {
 		mode = 8
 		name = "SPF List"
 		checkSPF = true
+	case "attachment":
+		mode = 10
+		name = "Attachment"
+	case "attachment.type":
+		mode = 11
+		name = "Attachment Type"
+	case "attachment.hash":
+		mode = 12
+		name = "Attachment SHA-256"
 	default:
 		name = emailCountBy
 		mode = 8
 	}
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			i++
 			l := string(v)
 			email := getMailInfo(&l)
 			if email == nil {
-				continue
+				return true
 			}
-			if matchFilter(&l) {
+			if matchFilter(&l) && matchEmailAttachment(email) {
 				switch mode {
 				case 1:
 					countMap[email.To]++
@@ -485,6 +485,17 @@ func emailCountSub(wg *sync.WaitGroup) {
 				case 9:
 					k := email.Msg.Header.Get(emailCountBy)
 					countMap[k]++
+				case 10, 11, 12:
+					for _, a := range email.Attachments {
+						switch mode {
+						case 10:
+							countMap[a.Name]++
+						case 11:
+							countMap[a.Type]++
+						default:
+							countMap[a.SHA256]++
+						}
+					}
 				case 0:
 					// TIME
 					d := t / intv
@@ -495,10 +506,10 @@ func emailCountSub(wg *sync.WaitGroup) {
 			}
 			teaProg.Send(SearchMsg{Lines: i, Hit: hit, Dur: time.Since(st)})
 			if stopSearch {
-				break
+				return false
 			}
-		}
-		return nil
+			return true
+		})
 	})
 	for k, v := range countMap {
 		countList = append(countList, countEnt{
@@ -651,10 +662,29 @@ func getMailInfo(l *string) *emailSearchDataEnt {
 	r.SPFList = strings.Join(spfs, ",")
 	*l += "SPF-List: " + r.SPFList + "\r\n"
 	*l += "SPF: " + r.SPF + "\r\n"
+	for _, v := range msg.Header[emailAttachmentHeader] {
+		if a, ok := parseEMailAttachment(v); ok {
+			r.Attachments = append(r.Attachments, a)
+			*l += "Attachment: " + a.String() + "\r\n"
+		}
+	}
 	r.Log = l
 	return r
 }
 
+// matchEmailAttachment : check --attachment filter with attachments of email
+func matchEmailAttachment(e *emailSearchDataEnt) bool {
+	if emailAttachmentRe == nil {
+		return true
+	}
+	for _, a := range e.Attachments {
+		if emailAttachmentRe.MatchString(a.String()) {
+			return true
+		}
+	}
+	return false
+}
+
 func extractDomain(addr string) string {
 	if strings.Contains(addr, "@") {
 		parts := strings.Split(addr, "@")
@@ -705,6 +735,29 @@ func getSPF(ip net.IP, helo, sender string) (string, string) {
 	return string(r), ""
 }
 
+// needEmailSPF : check SPF by --checkSPF or count by SPF
+func needEmailSPF() bool {
+	return checkSPF || emailCountBy == "spf" || emailCountBy == "spf.list"
+}
+
+// openEmailDB : open datastore writable to save SPF cache when SPF is checked.
+// Datastore locked by import is opened read only without saving SPF cache.
+func openEmailDB() {
+	if _, err := os.Stat(dataStore); err != nil {
+		log.Fatalln(err)
+	}
+	if needEmailSPF() {
+		err := openDB()
+		if err == nil {
+			return
+		}
+		log.Printf("%v. SPF cache is not saved", err)
+	}
+	if err := openDBReadOnly(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
 func loadEmailSPFMap() {
 	db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte("emailSPF"))
@@ -719,14 +772,20 @@ func loadEmailSPFMap() {
 	})
 }
 
-func saveEmailSPFMap() {
-	db.Batch(func(tx *bbolt.Tx) error {
+// saveEmailSPFMap : save SPF cache. Read only datastore is not saved.
+func saveEmailSPFMap() error {
+	if len(emailSPFMap) < 1 || db.IsReadOnly() {
+		return nil
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte("emailSPF"))
 		if err != nil {
-			log.Fatalln(err)
+			return err
 		}
 		for k, v := range emailSPFMap {
-			b.Put([]byte(k), []byte(v))
+			if err := b.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -65,3 +66,37 @@ func TestExtractIP(t *testing.T) {
 		}
 	}
 }
+
+func TestEmailSPFCache(t *testing.T) {
+	defer func() {
+		checkSPF, emailCountBy = false, "time"
+		emailSPFMap = make(map[string]string)
+	}()
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	// Count by SPF opens writable datastore to save cache
+	emailCountBy = "spf"
+	openEmailDB()
+	if db.IsReadOnly() {
+		t.Fatal("datastore is read only")
+	}
+	emailSPFMap["192.0.2.1/mx.example.com/a@example.com"] = "pass"
+	if err := saveEmailSPFMap(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	emailSPFMap = make(map[string]string)
+	emailCountBy = "time"
+	openEmailDB()
+	defer db.Close()
+	if !db.IsReadOnly() {
+		t.Error("datastore is not read only without SPF check")
+	}
+	loadEmailSPFMap()
+	if emailSPFMap["192.0.2.1/mx.example.com/a@example.com"] != "pass" {
+		t.Errorf("SPF cache is not saved %v", emailSPFMap)
+	}
+}
@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -28,7 +27,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/PaesslerAG/jsonpath"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -51,6 +49,8 @@ Extract regex pattern in logs.
  $twsla extract -e "key=%{number}"
 Extract json key.
  $twsla extract -e json -n Score
+Extract key=value of log.
+ $twsla extract -e kv -n user
 Extract field of log
  $twsla extract -e field -p 0
 Extract csv of log
@@ -73,6 +73,7 @@ func init() {
 	extractCmd.Flags().StringVarP(&grokDef, "grok", "g", "", "grok pattern definitions")
 	extractCmd.Flags().StringVar(&geoipDBPath, "geoip", "", "geo IP database file")
 	extractCmd.Flags().StringVar(&ipInfoMode, "ip", "", "IP info mode(host|domain|loc|country)")
+	extractCmd.Flags().StringVar(&sourceFilter, "source", "", "Source path filter")
 }
 
 func extractMain() {
@@ -80,7 +81,7 @@ func extractMain() {
 		name = "Value"
 	}
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -93,6 +94,7 @@ func extractMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type extractEnt struct {
@@ -111,10 +113,11 @@ func extractSub(wg *sync.WaitGroup) {
 	sep := ""
 	ipm := getIPInfoMode()
 	switch extract {
-	case "json":
+	case "json", "kv":
 		mode = 1
 	case "grok":
-		mode = 2
+		mode = 1
+		setStoredGrok()
 		setGrok()
 		if gr == nil {
 			log.Fatalln("no grok")
@@ -134,90 +137,54 @@ func extractSub(wg *sync.WaitGroup) {
 		}
 	}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	i := 0
-	hit := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
+	var i, hit int
+	i, hit, scanErr = scanLogsParallel(sti, eti, scanOpt{
+		Ordered: true,
+		Progress: func(lines, hit int) {
+			teaProg.Send(SearchMsg{Lines: lines, Hit: hit, Dur: time.Since(st)})
+		},
+	}, func(tx *bbolt.Tx) func(e *logEnt) (string, bool) {
+		fb := getFieldBucket(tx, extract, name)
+		cols := getColumnMap(tx)
+		useCols := mode == 4 && cols.has(name)
+		return func(e *logEnt) (string, bool) {
+			if !matchFilter(&e.Log) {
+				return "", false
 			}
-			l := string(v)
-			i++
-			if matchFilter(&l) {
-				switch mode {
-				case 1:
-					// JSON
-					var data map[string]interface{}
-					if ji := strings.IndexByte(string(v), '{'); ji >= 0 {
-						if err := json.Unmarshal(v[ji:], &data); err == nil {
-							if val, err := jsonpath.Get(name, data); err == nil && val != nil {
-								if ipm > 0 {
-									ip := fmt.Sprintf("%v", val)
-									extractList = append(extractList, extractEnt{Time: t, Value: fmt.Sprintf("%s(%s)", ip, getIPInfo(ip, ipm))})
-								} else {
-									extractList = append(extractList, extractEnt{Time: t, Value: fmt.Sprintf("%v", val)})
-								}
-								hit++
-							}
-						}
-					}
-				case 2:
-					// GROK
-					if data, err := gr.ParseString(l); err == nil {
-						if val, ok := data[name]; ok {
-							if ipm > 0 {
-								val = fmt.Sprintf("%s(%s)", val, getIPInfo(val, ipm))
-							}
-							extractList = append(extractList, extractEnt{Time: t, Value: val})
-							hit++
-						}
-					}
-				case 3:
-					f := strings.Fields(l)
-					if pos < len(f) {
-						val := strings.TrimSpace(f[pos])
-						if val != "" {
-							extractList = append(extractList, extractEnt{Time: t, Value: val})
-						}
-					}
-				case 4:
-					f := strings.Split(l, sep)
-					if pos < len(f) {
-						val := strings.TrimSpace(f[pos])
-						if val != "" {
-							extractList = append(extractList, extractEnt{Time: t, Value: val})
-						}
-					}
-				default:
-					// TWSLA
-					a := extPat.ExtReg.FindAllStringSubmatch(l, -1)
-					if len(a) >= extPat.Index && len(a[extPat.Index-1]) > 1 {
-						if ipm > 0 {
-							ip := a[extPat.Index-1][1]
-							extractList = append(extractList, extractEnt{Time: t, Value: fmt.Sprintf("%s(%s)", ip, getIPInfo(ip, ipm))})
-						} else {
-							extractList = append(extractList, extractEnt{Time: t, Value: a[extPat.Index-1][1]})
-						}
-						hit++
-					}
+			switch mode {
+			case 1:
+				// JSON,KV,GROK
+				return getField(fb, extract, name, e.Key, []byte(e.Log))
+			case 3:
+				f := strings.Fields(e.Log)
+				if pos < len(f) {
+					val := strings.TrimSpace(f[pos])
+					return val, val != ""
+				}
+			case 4:
+				if useCols {
+					return cols.value(e.Key, e.Log, name)
+				}
+				f := strings.Split(e.Log, sep)
+				if pos < len(f) {
+					val := strings.TrimSpace(f[pos])
+					return val, val != ""
+				}
+			default:
+				// TWSLA
+				a := extPat.ExtReg.FindAllStringSubmatch(e.Log, -1)
+				if len(a) >= extPat.Index && len(a[extPat.Index-1]) > 1 {
+					return a[extPat.Index-1][1], true
 				}
 			}
-			if i%100 == 0 {
-				teaProg.Send(SearchMsg{Lines: i, Hit: hit, Dur: time.Since(st)})
-			}
-			if stopSearch {
-				break
-			}
+			return "", false
+		}
+	}, func(e *logEnt, val string) bool {
+		if ipm > 0 && (mode == 1 || mode == 0) {
+			val = fmt.Sprintf("%s(%s)", val, getIPInfo(val, ipm))
 		}
-		return nil
+		extractList = append(extractList, extractEnt{Time: e.Time, Value: val})
+		return true
 	})
 	for i := 0; i < len(extractList); i++ {
 		if v, err := strconv.ParseFloat(extractList[i].Value, 64); err == nil {
@@ -0,0 +1,307 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PaesslerAG/jsonpath"
+	"go.etcd.io/bbolt"
+)
+
+// Structured fields
+//
+// fields bucket has one bucket per field name.
+// Each field bucket has the value of the field keyed by log key.
+// meta "fields" is the mode used to extract fields (json|kv|grok).
+
+var fieldsMode string
+
+// setupFields : extract fields of logs at import time
+func setupFields() error {
+	var mode, pat, def string
+	db.View(func(tx *bbolt.Tx) error {
+		mode = getMeta(tx, "fields")
+		pat = getMeta(tx, "fieldsGrokPat")
+		def = getMeta(tx, "fieldsGrokDef")
+		return nil
+	})
+	if mode != "" {
+		if fieldsMode != "" && fieldsMode != mode {
+			return fmt.Errorf("datastore has %s fields", mode)
+		}
+		if mode == "grok" {
+			grokPat = pat
+			grokDef = def
+			setGrok()
+		}
+		return nil
+	}
+	switch fieldsMode {
+	case "":
+		return nil
+	case "json", "kv":
+	case "grok":
+		if grokPat == "" {
+			return fmt.Errorf("grok fields needs grok pattern")
+		}
+		setGrok()
+	default:
+		return fmt.Errorf("invalid fields mode %s", fieldsMode)
+	}
+	fmt.Fprintln(os.Stderr, "Extracting fields...")
+	var lk []byte
+	for {
+		n := 0
+		if err := db.Update(func(tx *bbolt.Tx) error {
+			sk := []byte{}
+			if lk != nil {
+				sk = append(append([]byte{}, lk...), 0)
+			}
+			var err error
+			serr := newLogStore(tx).seek(sk, func(k, v []byte) bool {
+				if n >= batchSize {
+					return false
+				}
+				if err = addFields(tx, k, string(v), fieldsMode); err != nil {
+					return false
+				}
+				lk = append(lk[:0], k...)
+				n++
+				return true
+			})
+			if serr != nil {
+				return serr
+			}
+			if err != nil {
+				return err
+			}
+			if n < batchSize {
+				if fieldsMode == "grok" {
+					if err := setMeta(tx, "fieldsGrokPat", grokPat); err != nil {
+						return err
+					}
+					if err := setMeta(tx, "fieldsGrokDef", grokDef); err != nil {
+						return err
+					}
+				}
+				return setMeta(tx, "fields", fieldsMode)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
+
+// getFields : extract fields from log
+func getFields(mode, l string) map[string]string {
+	r := make(map[string]string)
+	switch mode {
+	case "json":
+		ji := strings.IndexByte(l, '{')
+		if ji < 0 {
+			return r
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(l[ji:]), &data); err == nil {
+			flattenJSON("", data, r)
+		}
+	case "kv":
+		return parseKV(l)
+	case "grok":
+		if gr == nil {
+			return r
+		}
+		if data, err := parseGrok(l); err == nil {
+			for k, v := range data {
+				r[k] = v
+			}
+		}
+	}
+	return r
+}
+
+// parseGrok : parse log by grok pattern.
+// Log with the tag of inventory host is parsed without the tag first,
+// so patterns anchored at the head of line match.
+func parseGrok(l string) (map[string]string, error) {
+	if t := trimHostTag(l); t != l {
+		if data, err := gr.ParseString(t); err == nil && data != nil {
+			return data, nil
+		}
+	}
+	return gr.ParseString(l)
+}
+
+// flattenJSON : get leaf values of json with key like a.b[0].c
+func flattenJSON(prefix string, v interface{}, r map[string]string) {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vv {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flattenJSON(p, e, r)
+		}
+	case []interface{}:
+		for i, e := range vv {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), e, r)
+		}
+	case nil:
+	default:
+		if prefix != "" {
+			r[prefix] = fmt.Sprintf("%v", vv)
+		}
+	}
+}
+
+// parseKV : parse key=value or key="value" pairs like logfmt
+func parseKV(l string) map[string]string {
+	r := make(map[string]string)
+	for i := 0; i < len(l); {
+		e := strings.IndexByte(l[i:], '=')
+		if e < 0 {
+			break
+		}
+		e += i
+		ks := strings.LastIndexAny(l[i:e], " \t,;") + 1 + i
+		k := l[ks:e]
+		i = e + 1
+		var v string
+		if i < len(l) && l[i] == '"' {
+			j := i + 1
+			for j < len(l) && l[j] != '"' {
+				if l[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			v = strings.ReplaceAll(l[i+1:min(j, len(l))], `\"`, `"`)
+			i = j + 1
+		} else {
+			j := strings.IndexAny(l[i:], " \t,;")
+			if j < 0 {
+				j = len(l) - i
+			}
+			v = l[i : i+j]
+			i += j
+		}
+		if k != "" {
+			r[k] = v
+		}
+	}
+	return r
+}
+
+// addFields : save fields of log to field buckets
+func addFields(tx *bbolt.Tx, id []byte, l, mode string) error {
+	fields := getFields(mode, l)
+	if len(fields) < 1 {
+		return nil
+	}
+	bf, err := tx.CreateBucketIfNotExists([]byte("fields"))
+	if err != nil {
+		return err
+	}
+	for k, v := range fields {
+		b, err := bf.CreateBucketIfNotExists([]byte(k))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(id, []byte(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delFields : delete fields of log from field buckets
+func delFields(tx *bbolt.Tx, id []byte, l, mode string) error {
+	bf := tx.Bucket([]byte("fields"))
+	if bf == nil {
+		return nil
+	}
+	for k := range getFields(mode, l) {
+		b := bf.Bucket([]byte(k))
+		if b == nil {
+			continue
+		}
+		if err := b.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFieldBucket : get field bucket when datastore has fields extracted by mode
+func getFieldBucket(tx *bbolt.Tx, mode, name string) *bbolt.Bucket {
+	if getMeta(tx, "fields") != mode {
+		return nil
+	}
+	switch mode {
+	case "json":
+		name = strings.TrimPrefix(name, "$.")
+	case "grok":
+		if getMeta(tx, "fieldsGrokPat") != grokPat || getMeta(tx, "fieldsGrokDef") != grokDef {
+			return nil
+		}
+	}
+	bf := tx.Bucket([]byte("fields"))
+	if bf == nil || name == "" {
+		return nil
+	}
+	return bf.Bucket([]byte(name))
+}
+
+// getField : get value of field from field bucket or log
+func getField(fb *bbolt.Bucket, mode, name string, k, v []byte) (string, bool) {
+	if fb != nil {
+		if val := fb.Get(k); val != nil {
+			return string(val), true
+		}
+		return "", false
+	}
+	switch mode {
+	case "json":
+		var data map[string]interface{}
+		if ji := strings.IndexByte(string(v), '{'); ji >= 0 {
+			if err := json.Unmarshal(v[ji:], &data); err == nil {
+				if val, err := jsonpath.Get(name, data); err == nil && val != nil {
+					return fmt.Sprintf("%v", val), true
+				}
+			}
+		}
+	case "grok":
+		if data, err := parseGrok(string(v)); err == nil {
+			if val, ok := data[name]; ok {
+				return val, true
+			}
+		}
+	case "kv":
+		if val, ok := parseKV(string(v))[name]; ok {
+			return val, true
+		}
+	}
+	return "", false
+}
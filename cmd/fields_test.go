@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestParseKV(t *testing.T) {
+	tests := []struct {
+		input string
+		want  map[string]string
+	}{
+		{"level=info msg=started", map[string]string{"level": "info", "msg": "started"}},
+		{`time=10:00 user="john smith" ok=true`, map[string]string{"time": "10:00", "user": "john smith", "ok": "true"}},
+		{`a=1,b=2;c="x \"y\""`, map[string]string{"a": "1", "b": "2", "c": `x "y"`}},
+		{"Jan 1 sshd: no kv", map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := parseKV(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseKV(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGetFieldsJSON(t *testing.T) {
+	got := getFields("json", `2024-01-01 {"Event":{"System":{"EventID":4624,"Computer":"pc1"}},"Tags":["a","b"],"N":null}`)
+	want := map[string]string{
+		"Event.System.EventID":  "4624",
+		"Event.System.Computer": "pc1",
+		"Tags[0]":               "a",
+		"Tags[1]":               "b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getFields json = %v, want %v", got, want)
+	}
+}
+
+func TestFieldStore(t *testing.T) {
+	var err error
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err = openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	batchSize = 2
+	logs := []logBufEnt{}
+	for i := 0; i < 5; i++ {
+		logs = append(logs, logBufEnt{
+			ID:  []byte(fmt.Sprintf("%016x:00:%x", i, i)),
+			Log: []byte(fmt.Sprintf(`{"Score":%d,"User":{"Name":"u%d"}}`, i, i%2)),
+		})
+	}
+	// Fields of logs saved before setup are extracted by setupFields.
+	if err = saveLogs(logs[:3], getDataStoreInfo()); err != nil {
+		t.Fatal(err)
+	}
+	fieldsMode = "json"
+	defer func() { fieldsMode = "" }()
+	if err = setupFields(); err != nil {
+		t.Fatal(err)
+	}
+	if err = saveLogs(logs[3:], getDataStoreInfo()); err != nil {
+		t.Fatal(err)
+	}
+	fieldsMode = "kv"
+	if err = setupFields(); err == nil {
+		t.Error("setupFields with other mode must fail")
+	}
+	db.Update(func(tx *bbolt.Tx) error {
+		return deleteLogs(tx, []logKV{{Key: logs[4].ID, Log: logs[4].Log}})
+	})
+	db.View(func(tx *bbolt.Tx) error {
+		if fb := getFieldBucket(tx, "kv", "Score"); fb != nil {
+			t.Error("getFieldBucket kv must be nil")
+		}
+		if fb := getFieldBucket(tx, "json", "$.User.Name"); fb == nil || fb.Stats().KeyN != 4 {
+			t.Error("getFieldBucket $.User.Name must have 4 values")
+		}
+		fb := getFieldBucket(tx, "json", "Score")
+		if fb == nil {
+			t.Fatal("getFieldBucket Score is nil")
+		}
+		for i, l := range logs {
+			val, ok := getField(fb, "json", "Score", l.ID, l.Log)
+			if i == 4 {
+				if ok {
+					t.Errorf("getField deleted log got %s", val)
+				}
+				continue
+			}
+			if raw, _ := getField(nil, "json", "Score", l.ID, l.Log); !ok || val != raw {
+				t.Errorf("getField %d got %s %v, want %s", i, val, ok, raw)
+			}
+		}
+		return nil
+	})
+}
@@ -22,7 +22,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -58,7 +57,7 @@ func init() {
 
 func heatmapMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -71,6 +70,7 @@ func heatmapMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type heapmapEnt struct {
@@ -89,21 +89,10 @@ func heatmapSub(wg *sync.WaitGroup) {
 	var dateMap = make(map[string]bool)
 	defer wg.Done()
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	i := 0
 	hit := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			i++
 			if matchFilter(&l) {
@@ -142,10 +131,10 @@ func heatmapSub(wg *sync.WaitGroup) {
 				teaProg.Send(SearchMsg{Lines: i, Hit: hit, Dur: time.Since(st)})
 			}
 			if stopSearch {
-				break
+				return false
 			}
-		}
-		return nil
+			return true
+		})
 	})
 	for _, v := range heatmapMap {
 		heatmapList = append(heatmapList, v)
@@ -0,0 +1,207 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Archive walker
+//
+// Compression and archive formats are detected by magic bytes and
+// walked recursively, so that files in nested archives such as zip in tar.gz
+// are imported. The path of file in archive is "archive:name".
+
+const maxArchiveDepth = 8
+
+// archiveEnt : file found by walkArchive
+type archiveEnt struct {
+	Path   string
+	Reader io.Reader
+	// Kind is evtx or journal for formats that need random access, and
+	// File is the local file to read them.
+	Kind string
+	File string
+}
+
+type archiveWalker struct {
+	fn     func(*archiveEnt) error
+	filter *regexp.Regexp
+}
+
+// walkArchive : call fn for each file in r. filter is applied to the names of files in archives
+// unless the name of archive itself matches it.
+func walkArchive(path string, r io.Reader, filter *regexp.Regexp, fn func(*archiveEnt) error) error {
+	if filter != nil && filter.MatchString(filepath.Base(path)) {
+		filter = nil
+	}
+	w := &archiveWalker{fn: fn, filter: filter}
+	return w.walk(path, r, 0, "")
+}
+
+// getArchiveFormat : get archive or compression format from head of file
+func getArchiveFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte("BZh")) && len(head) > 3 && head[3] >= '1' && head[3] <= '9':
+		return "bzip2"
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return "xz"
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")) || bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return "zip"
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return "tar"
+	case bytes.HasPrefix(head, []byte("ElfFile\x00")):
+		return "evtx"
+	case bytes.HasPrefix(head, []byte("LPKSHHRH")):
+		return "journal"
+	}
+	return ""
+}
+
+// walk : name is the name in parent archive or "" for the top.
+func (w *archiveWalker) walk(path string, r io.Reader, depth int, name string) error {
+	if stopImport {
+		return nil
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(512)
+	format := getArchiveFormat(head)
+	if depth > maxArchiveDepth {
+		format = ""
+	}
+	switch format {
+	case "gzip":
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gzr.Close()
+		return w.walk(path, gzr, depth+1, name)
+	case "bzip2":
+		return w.walk(path, bzip2.NewReader(br), depth+1, name)
+	case "xz":
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return w.walk(path, xr, depth+1, name)
+	case "zstd":
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		return w.walk(path, zr, depth+1, name)
+	case "tar":
+		tr := tar.NewReader(br)
+		for {
+			f, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if f.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := w.walk(path+":"+f.Name, tr, depth+1, f.Name); err != nil {
+				return err
+			}
+		}
+	case "zip":
+		return w.withFile(path, br, r, "twsla*.zip", func(file string) error {
+			zr, err := zip.OpenReader(file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			defer zr.Close()
+			for _, f := range zr.File {
+				if f.FileInfo().IsDir() {
+					continue
+				}
+				fr, err := f.Open()
+				if err != nil {
+					continue
+				}
+				err = w.walk(path+":"+f.Name, fr, depth+1, f.Name)
+				fr.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if name != "" && w.filter != nil && !w.filter.MatchString(filepath.Base(name)) {
+		return nil
+	}
+	switch format {
+	case "evtx", "journal":
+		return w.withFile(path, br, r, "twsla*."+format, func(file string) error {
+			return w.fn(&archiveEnt{Path: path, Kind: format, File: file})
+		})
+	}
+	return w.fn(&archiveEnt{Path: path, Reader: br})
+}
+
+// withFile : call fn with local file of stream. Files in archives are copied to temporary file.
+func (w *archiveWalker) withFile(path string, br *bufio.Reader, r io.Reader, pat string, fn func(string) error) error {
+	if f, ok := r.(*os.File); ok {
+		return fn(f.Name())
+	}
+	t, err := os.CreateTemp("", pat)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(t.Name())
+	_, err = io.Copy(t, br)
+	t.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return fn(t.Name())
+}
+
+// importArchiveEnt : import file found by walkArchive
+func importArchiveEnt(e *archiveEnt) error {
+	switch e.Kind {
+	case "evtx":
+		importFromWindowsEvtx(e.Path, e.File)
+	case "journal":
+		return importFromJournalFile(e.Path, e.File)
+	default:
+		doImport(e.Path, e.Reader)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func testGzip(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	names := []string{}
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		f, err := w.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(files[n])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testTar(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	names := []string{}
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := w.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(files[n]))}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(files[n])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWalkArchive(t *testing.T) {
+	var xzBuf bytes.Buffer
+	xw, err := xz.NewWriter(&xzBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xw.Write([]byte("xz log\n"))
+	xw.Close()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := zw.EncodeAll(testTar(t, map[string][]byte{"zst.log": []byte("zstd log\n")}), nil)
+	zw.Close()
+	inner := testZip(t, map[string][]byte{
+		"a.log.gz":  testGzip(t, []byte("gz in zip\n")),
+		"skip.txt":  []byte("skip\n"),
+		"b.log.xz":  xzBuf.Bytes(),
+		"c.tar.zst": zst,
+	})
+	top := testGzip(t, testTar(t, map[string][]byte{
+		"dir/inner.zip": inner,
+		"plain.log":     []byte("plain\n"),
+	}))
+	path := filepath.Join(t.TempDir(), "logs.tgz")
+	if err := os.WriteFile(path, top, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stopImport = false
+	got := map[string]string{}
+	err = walkArchive(path, f, getSimpleFilter("*.log"), func(e *archiveEnt) error {
+		b, err := io.ReadAll(e.Reader)
+		got[e.Path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		path + ":dir/inner.zip:a.log.gz":          "gz in zip\n",
+		path + ":dir/inner.zip:b.log.xz":          "xz log\n",
+		path + ":dir/inner.zip:c.tar.zst:zst.log": "zstd log\n",
+		path + ":plain.log":                       "plain\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walkArchive got %v, want %v", got, want)
+	}
+}
+
+func TestGetArchiveFormat(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want string
+	}{
+		{[]byte{0x1f, 0x8b, 8}, "gzip"},
+		{[]byte("BZh91AY"), "bzip2"},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0, 0}, "xz"},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0}, "zstd"},
+		{[]byte("PK\x03\x04abcd"), "zip"},
+		{[]byte("ElfFile\x00"), "evtx"},
+		{[]byte("LPKSHHRH"), "journal"},
+		{[]byte("Jan  1 00:00:00 host test"), ""},
+	}
+	for _, tt := range tests {
+		if got := getArchiveFormat(tt.head); got != tt.want {
+			t.Errorf("getArchiveFormat(%q) got %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
@@ -17,25 +17,63 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
+	"net/textproto"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/araddon/dateparse"
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
 	"github.com/knadh/go-pop3"
+	"github.com/xhit/go-str2duration/v2"
+	"go.etcd.io/bbolt"
 )
 
+// EMail import
+//
+// IMAP and POP3 import fetch only new messages. UID of IMAP mailbox and UIDL of POP3
+// are saved in emailSync bucket of datastore, and --emailResync fetches all messages again.
+// --since is the SINCE search criterion of IMAP.
+// Attachments are saved as X-Twsla-Attachment header with type, size, SHA-256 and name.
+
+var emailSince string
+var emailResync bool
+
+const emailAttachmentHeader = "X-Twsla-Attachment"
+
+type emailAttachment struct {
+	Name   string
+	Type   string
+	Size   int64
+	SHA256 string
+}
+
 func importEMailFile(path string, r io.Reader) {
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	hash := getSHA1(path)
+	readBytes, readLines, skipLines := importEMailMsg(path, hash, 1, r)
+	recordSource(path, hash, readBytes, readLines, skipLines)
+}
+
+// importEMailMsg : import header and attachments of a mail message as a log.
+// Returns read bytes, lines and skip lines. Read lines is 0 if the message is not stored.
+func importEMailMsg(path, hash string, line int, r io.Reader) (int64, int, int) {
 	st, et := getTimeRange()
 	if stopImport {
-		return
+		return 0, 0, 0
 	}
 	msg, err := mail.ReadMessage(r)
 	if err != nil {
@@ -44,7 +82,7 @@ func importEMailFile(path string, r io.Reader) {
 			Path: path,
 			Skip: 1,
 		})
-		return
+		return 0, 0, 1
 	}
 	ts, err := msg.Header.Date()
 	t := ts.UnixNano()
@@ -54,7 +92,7 @@ func importEMailFile(path string, r io.Reader) {
 			Path: path,
 			Skip: 1,
 		})
-		return
+		return 0, 0, 1
 	}
 	a := []string{}
 	for k, va := range msg.Header {
@@ -62,6 +100,9 @@ func importEMailFile(path string, r io.Reader) {
 			a = append(a, fmt.Sprintf("%s: %s", k, v))
 		}
 	}
+	for _, at := range getEMailAttachments(msg.Header, msg.Body, 0) {
+		a = append(a, emailAttachmentHeader+": "+at.header())
+	}
 	l := strings.Join(a, "\r\n")
 	l += "\r\n"
 	if importFilter != nil && !importFilter.MatchString(l) {
@@ -70,15 +111,14 @@ func importEMailFile(path string, r io.Reader) {
 			Path: path,
 			Skip: 1,
 		})
-		return
+		return 0, 0, 1
 	}
-	totalLines += len(a)
-	totalBytes += int64(len(l))
+	addImportTotal(0, len(a), int64(len(l)))
 	logCh <- &LogEnt{
 		Time: t,
 		Log:  l,
 		Hash: hash,
-		Line: len(a),
+		Line: line,
 	}
 	teaProg.Send(ImportMsg{
 		Done:  false,
@@ -86,6 +126,7 @@ func importEMailFile(path string, r io.Reader) {
 		Bytes: int64(len(l)),
 		Lines: len(a),
 	})
+	return int64(len(l)), len(a), 0
 }
 
 func doListIMAPFolder() {
@@ -107,17 +148,28 @@ func doListIMAPFolder() {
 }
 
 func importEMailIMAP() {
+	if err := importEMailIMAPSub(); err != nil {
+		teaProg.Send(err)
+	}
+}
+
+// importEMailIMAPSub : fetch messages that have UID after the saved UID of the mailbox
+func importEMailIMAPSub() error {
+	since, err := getEMailSince()
+	if err != nil {
+		return err
+	}
 	c, err := getIMAPClient()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	defer c.Logout()
 	if err := c.Login(emailUser, emailPassword).Wait(); err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	u, err := url.Parse(source)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	mbox := "INBOX"
 	if len(u.Path) > 1 {
@@ -125,37 +177,138 @@ func importEMailIMAP() {
 	}
 	status, err := c.Select(mbox, nil).Wait()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	if status.NumMessages == 0 {
-		log.Fatalf("mail box %s is empty", mbox)
-	}
-	var seqSet imap.SeqSet
-	seqSet.AddRange(1, status.NumMessages)
-	headerSection := imap.FetchItemBodySection{Specifier: imap.PartSpecifierHeader}
-	fetchOptions := &imap.FetchOptions{
-		Envelope:    true,
-		BodySection: []*imap.FetchItemBodySection{&headerSection},
-	}
-	fetchCmd := c.Fetch(seqSet, fetchOptions)
-	defer fetchCmd.Close()
-	for {
-		msg := fetchCmd.Next()
-		if msg == nil {
-			break
+		return fmt.Errorf("mail box %s is empty", mbox)
+	}
+	key := getEMailSyncKey(u, mbox)
+	lastUID := getIMAPLastUID(loadEMailSync(key), status.UIDValidity)
+	criteria := &imap.SearchCriteria{Since: since}
+	if lastUID > 0 {
+		criteria.UID = []imap.UIDSet{{imap.UIDRange{Start: lastUID + 1, Stop: 0}}}
+	}
+	data, err := c.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		return err
+	}
+	var uidSet imap.UIDSet
+	uids := []imap.UID{}
+	for _, uid := range data.AllUIDs() {
+		// n:* has the last message even if its UID is less than n
+		if uid > lastUID {
+			uidSet.AddNum(uid)
+			uids = append(uids, uid)
 		}
-		buf, err := msg.Collect()
-		if err != nil {
-			log.Printf("failed to collect message: %v", err)
-			continue
+	}
+	addImportTotal(1, 0, 0)
+	hash := getSHA1(source)
+	readBytes := int64(0)
+	readLines := 0
+	skipLines := 0
+	stored := make(map[imap.UID]bool)
+	if len(uidSet) > 0 {
+		bodySection := imap.FetchItemBodySection{Peek: true}
+		fetchOptions := &imap.FetchOptions{
+			UID:         true,
+			BodySection: []*imap.FetchItemBodySection{&bodySection},
 		}
-		headerData := buf.FindBodySection(&headerSection)
-		if len(headerData) < 1 {
-			continue
+		fetchCmd := c.Fetch(uidSet, fetchOptions)
+		for !stopImport {
+			msg := fetchCmd.Next()
+			if msg == nil {
+				break
+			}
+			buf, err := msg.Collect()
+			if err != nil {
+				log.Printf("failed to collect message: %v", err)
+				continue
+			}
+			data := buf.FindBodySection(&bodySection)
+			if len(data) < 1 {
+				continue
+			}
+			b, l, sk := importEMailMsg(fmt.Sprintf("%s#%d", source, buf.UID), hash, int(buf.UID), bytes.NewReader(data))
+			readBytes += b
+			readLines += l
+			skipLines += sk
+			if l > 0 {
+				stored[buf.UID] = true
+			}
+		}
+		if err := fetchCmd.Close(); err != nil {
+			return err
+		}
+	}
+	// Saved UID stops before the first message not stored to fetch it again
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	maxUID := lastUID
+	for _, uid := range uids {
+		if !stored[uid] {
+			break
 		}
-		importEMailFile(fmt.Sprintf("%s#%d", source, msg.SeqNum), bytes.NewReader(headerData))
+		maxUID = uid
 	}
+	saveEMailSync(key, fmt.Sprintf("%d:%d", status.UIDValidity, maxUID))
+	recordSource(source, hash, readBytes, readLines, skipLines)
+	return nil
+}
 
+// getIMAPLastUID : saved UID is valid only if UIDVALIDITY of the mailbox is not changed
+func getIMAPLastUID(v string, validity uint32) imap.UID {
+	if emailResync {
+		return 0
+	}
+	a := strings.SplitN(v, ":", 2)
+	if len(a) != 2 || a[0] != strconv.FormatUint(uint64(validity), 10) {
+		return 0
+	}
+	uid, err := strconv.ParseUint(a[1], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return imap.UID(uid)
+}
+
+// getEMailSince : --since is date or duration like 7d
+func getEMailSince() (time.Time, error) {
+	if emailSince == "" {
+		return time.Time{}, nil
+	}
+	if d, err := str2duration.ParseDuration(emailSince); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := dateparse.ParseLocal(strings.ReplaceAll(emailSince, "/", "-"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %s: %w", emailSince, err)
+	}
+	return t, nil
+}
+
+// getEMailSyncKey : key of mailbox or POP3 account in emailSync bucket
+func getEMailSyncKey(u *url.URL, mbox string) string {
+	return fmt.Sprintf("%s://%s@%s/%s", u.Scheme, emailUser, u.Host, mbox)
+}
+
+func loadEMailSync(k string) string {
+	r := ""
+	db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte("emailSync")); b != nil {
+			r = string(b.Get([]byte(k)))
+		}
+		return nil
+	})
+	return r
+}
+
+func saveEMailSync(k, v string) {
+	db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("emailSync"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(k), []byte(v))
+	})
 }
 
 func getIMAPClient() (*imapclient.Client, error) {
@@ -187,32 +340,81 @@ func getIMAPClient() (*imapclient.Client, error) {
 }
 
 func importEMailPOP3() {
+	if err := importEMailPOP3Sub(); err != nil {
+		teaProg.Send(err)
+	}
+}
+
+// importEMailPOP3Sub : fetch messages that have UIDL not saved.
+// All messages are fetched if the server does not support UIDL.
+func importEMailPOP3Sub() error {
+	u, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
 	conn, err := getPOP3Conn()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	defer conn.Quit()
 
 	if err := conn.Auth(emailUser, emailPassword); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	count, _, err := conn.Stat()
+	if err != nil {
+		return err
 	}
-	count, _, _ := conn.Stat()
 	if count == 0 {
-		log.Fatalln("no messages on server")
+		return fmt.Errorf("no messages on server")
+	}
+	key := getEMailSyncKey(u, "")
+	seen := make(map[string]bool)
+	if !emailResync {
+		for _, uid := range strings.Split(loadEMailSync(key), "\n") {
+			seen[uid] = true
+		}
+	}
+	uidl := make(map[int]string)
+	if list, err := conn.Uidl(0); err == nil {
+		for _, m := range list {
+			uidl[m.ID] = m.UID
+		}
 	}
-	for i := 1; i < count+1; i++ {
-		msg, err := conn.Retr(count)
+	addImportTotal(1, 0, 0)
+	hash := getSHA1(source)
+	readBytes := int64(0)
+	readLines := 0
+	skipLines := 0
+	for i := 1; i < count+1 && !stopImport; i++ {
+		uid, ok := uidl[i]
+		if ok && seen[uid] {
+			continue
+		}
+		msg, err := conn.RetrRaw(i)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		b, l, sk := importEMailMsg(fmt.Sprintf("%s#%d", source, i), hash, i, msg)
+		readBytes += b
+		readLines += l
+		skipLines += sk
+		if ok && l > 0 {
+			seen[uid] = true
 		}
+	}
+	if len(uidl) > 0 {
+		// Keep UIDL of messages on server only
 		a := []string{}
-		for k, v := range msg.Header.Map() {
-			for _, val := range v {
-				a = append(a, fmt.Sprintf("%s: %s", k, val))
+		for i := 1; i < count+1; i++ {
+			if uid, ok := uidl[i]; ok && seen[uid] {
+				a = append(a, uid)
 			}
 		}
-		importEMailFile(fmt.Sprintf("%s#%d", source, i), strings.NewReader(strings.Join(a, "\r\n")+"\r\n"))
+		saveEMailSync(key, strings.Join(a, "\n"))
 	}
+	recordSource(source, hash, readBytes, readLines, skipLines)
+	return nil
 }
 
 func getPOP3Conn() (*pop3.Conn, error) {
@@ -224,9 +426,9 @@ func getPOP3Conn() (*pop3.Conn, error) {
 	port := u.Port()
 	if port == "" {
 		if u.Scheme == "pop3s" {
-			port = ":995"
+			port = "995"
 		} else {
-			port = ":110"
+			port = "110"
 		}
 	}
 	nport, err := strconv.Atoi(port)
@@ -246,3 +448,88 @@ func getPOP3Conn() (*pop3.Conn, error) {
 	})
 	return p.NewConn()
 }
+
+// getEMailAttachments : get attachments in multipart body.
+// Part that has file name or attachment disposition is an attachment.
+func getEMailAttachments(h map[string][]string, body io.Reader, depth int) []emailAttachment {
+	r := []emailAttachment{}
+	hdr := textproto.MIMEHeader(h)
+	mt, params, err := mime.ParseMediaType(hdr.Get("Content-Type"))
+	if err != nil {
+		mt = "text/plain"
+		params = map[string]string{}
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		if params["boundary"] == "" || depth > 10 {
+			return r
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			r = append(r, getEMailAttachments(p.Header, p, depth+1)...)
+		}
+		return r
+	}
+	disposition, dparams, _ := mime.ParseMediaType(hdr.Get("Content-Disposition"))
+	name := dparams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if name == "" && disposition != "attachment" {
+		return r
+	}
+	switch strings.ToLower(strings.TrimSpace(hdr.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	sh := sha256.New()
+	size, _ := io.Copy(sh, body)
+	return append(r, emailAttachment{
+		Name:   getMimeDecodedWord(name),
+		Type:   mt,
+		Size:   size,
+		SHA256: hex.EncodeToString(sh.Sum(nil)),
+	})
+}
+
+// header : value of X-Twsla-Attachment header. Name is the last because it may have "; ".
+func (a *emailAttachment) header() string {
+	return fmt.Sprintf("%s; size=%d; sha256=%s; name=%s", a.Type, a.Size, a.SHA256, strconv.Quote(a.Name))
+}
+
+func (a *emailAttachment) String() string {
+	return fmt.Sprintf("%s %s %d %s", a.Name, a.Type, a.Size, a.SHA256)
+}
+
+// parseEMailAttachment : parse value of X-Twsla-Attachment header
+func parseEMailAttachment(v string) (emailAttachment, bool) {
+	r := emailAttachment{}
+	a := strings.SplitN(v, "; ", 4)
+	if len(a) != 4 {
+		return r, false
+	}
+	r.Type = a[0]
+	size, ok := strings.CutPrefix(a[1], "size=")
+	if !ok {
+		return r, false
+	}
+	r.Size, _ = strconv.ParseInt(size, 10, 64)
+	if r.SHA256, ok = strings.CutPrefix(a[2], "sha256="); !ok {
+		return r, false
+	}
+	name, ok := strings.CutPrefix(a[3], "name=")
+	if !ok {
+		return r, false
+	}
+	if n, err := strconv.Unquote(name); err == nil {
+		r.Name = n
+	} else {
+		r.Name = name
+	}
+	return r, true
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+const testMailWithAttachments = "From: alice@example.com\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: report\r\n" +
+	"Date: Wed, 01 May 2024 10:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"see attached\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"report.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"aGVsbG8g\r\ncGRm\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/csv\r\n" +
+	"Content-Disposition: attachment; filename=\"=?UTF-8?B?44OH44O844K/LmNzdg==?=\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"a,b=3D1\r\n" +
+	"--outer--\r\n"
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestGetEMailAttachments(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader(testMailWithAttachments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := getEMailAttachments(msg.Header, msg.Body, 0)
+	want := []emailAttachment{
+		{Name: "report.pdf", Type: "application/pdf", Size: 9, SHA256: sha256Hex("hello pdf")},
+		{Name: "データ.csv", Type: "text/csv", Size: 5, SHA256: sha256Hex("a,b=1")},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("getEMailAttachments = %+v, want %+v", got, want)
+	}
+	for _, a := range want {
+		a.Name += `"; x`
+		if p, ok := parseEMailAttachment(a.header()); !ok || p != a {
+			t.Errorf("parseEMailAttachment(%q) = %+v", a.header(), p)
+		}
+	}
+}
+
+// runEMailImport : import source and return logs in datastore
+func runEMailImport(src string) []string {
+	source = src
+	emailUser, emailPassword = "", ""
+	return runImportTest(importOne)
+}
+
+func testMail(subject string, t time.Time) string {
+	return fmt.Sprintf("From: alice@example.com\r\nSubject: %s\r\nDate: %s\r\n\r\nbody\r\n", subject, t.Format(time.RFC1123Z))
+}
+
+func TestImportEMailIMAP(t *testing.T) {
+	defer func() { emailSince, emailResync, source = "", false, "" }()
+	user := imapmemserver.NewUser("bob", "secret")
+	if err := user.Create("INBOX", nil); err != nil {
+		t.Fatal(err)
+	}
+	add := func(s string, ti time.Time) {
+		if _, err := user.Append("INBOX", bytes.NewReader([]byte(s)), &imap.AppendOptions{Time: ti}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	memServer := imapmemserver.New()
+	memServer.AddUser(user)
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve(l)
+	src := "imap://bob:secret@" + l.Addr().String() + "/INBOX"
+
+	t1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	t2 := time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC)
+	add(testMailWithAttachments, t1)
+	add(testMail("second", t2), t2)
+	setupImportTest(t)
+	if got := runEMailImport(src); len(got) != 2 {
+		t.Fatalf("first import got %d logs", len(got))
+	}
+	// Only new message is fetched
+	add(testMail("third", t2.Add(time.Hour)), t2)
+	got := runEMailImport(src)
+	if len(got) != 3 {
+		t.Fatalf("second import got %d logs", len(got))
+	}
+	if v := loadEMailSync("imap://bob@" + l.Addr().String() + "/INBOX"); !strings.HasSuffix(v, ":3") {
+		t.Errorf("saved UID %q", v)
+	}
+	// Attachments in stored log
+	email := getMailInfo(&got[0])
+	if email == nil || len(email.Attachments) != 2 || email.Attachments[1].Name != "データ.csv" {
+		t.Fatalf("attachments %+v", email)
+	}
+	emailAttachmentRe = nil
+	if !matchEmailAttachment(email) {
+		t.Error("no filter does not match")
+	}
+	defer func() { emailAttachmentRe = nil }()
+	emailAttachmentRe = regexp.MustCompile(`\.pdf application/pdf 9 `)
+	if !matchEmailAttachment(email) || matchEmailAttachment(getMailInfo(&got[1])) {
+		t.Error("attachment filter is not matched")
+	}
+	if !strings.Contains(*email.Log, "Attachment: report.pdf application/pdf 9 "+sha256Hex("hello pdf")) {
+		t.Errorf("log has no attachment %q", *email.Log)
+	}
+	emailAttachmentRe = nil
+
+	// SINCE criterion on new datastore
+	setupImportTest(t)
+	emailSince = "2024-05-02"
+	if got := runEMailImport(src); len(got) != 2 || strings.Contains(strings.Join(got, ""), "report") {
+		t.Errorf("since import got %q", got)
+	}
+	// Resync fetches all messages again
+	emailSince, emailResync = "", true
+	if got := runEMailImport(src); len(got) != 3 {
+		t.Errorf("resync import got %d logs", len(got))
+	}
+	// Saved UID stops before the message dropped by filter
+	defer func() { importFilter = nil }()
+	setupImportTest(t)
+	emailResync = false
+	importFilter = regexp.MustCompile(`Subject: third|report\.pdf`)
+	if got := runEMailImport(src); len(got) != 2 {
+		t.Errorf("filtered import got %d logs", len(got))
+	}
+	if v := loadEMailSync("imap://bob@" + l.Addr().String() + "/INBOX"); !strings.HasSuffix(v, ":1") {
+		t.Errorf("saved UID after dropped message %q", v)
+	}
+	importFilter = nil
+	if got := runEMailImport(src); len(got) != 3 {
+		t.Errorf("import after filter got %d logs", len(got))
+	}
+	if v := loadEMailSync("imap://bob@" + l.Addr().String() + "/INBOX"); !strings.HasSuffix(v, ":3") {
+		t.Errorf("saved UID after import %q", v)
+	}
+}
+
+type testPOP3Box struct {
+	mu   sync.Mutex
+	msgs []string
+	uids []string
+}
+
+func (b *testPOP3Box) set(msgs, uids []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.msgs, b.uids = msgs, uids
+}
+
+// startTestPOP3Server : POP3 server with messages that have UIDL
+func startTestPOP3Server(t *testing.T, box *testPOP3Box) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "+OK ready\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					f := strings.Fields(line)
+					if len(f) < 1 {
+						continue
+					}
+					box.mu.Lock()
+					msgs, uids := box.msgs, box.uids
+					box.mu.Unlock()
+					switch strings.ToUpper(f[0]) {
+					case "STAT":
+						fmt.Fprintf(conn, "+OK %d 0\r\n", len(msgs))
+					case "UIDL":
+						fmt.Fprint(conn, "+OK\r\n")
+						for i, u := range uids {
+							fmt.Fprintf(conn, "%d %s\r\n", i+1, u)
+						}
+						fmt.Fprint(conn, ".\r\n")
+					case "RETR":
+						var i int
+						fmt.Sscan(f[1], &i)
+						fmt.Fprintf(conn, "+OK\r\n%s.\r\n", msgs[i-1])
+					case "QUIT":
+						fmt.Fprint(conn, "+OK\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "+OK\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestImportEMailPOP3(t *testing.T) {
+	defer func() { emailResync, source = false, "" }()
+	t1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	msgs := []string{testMail("first", t1), testMail("second", t1.Add(time.Hour))}
+	box := &testPOP3Box{}
+	box.set(msgs, []string{"uid-a", "uid-b"})
+	addr := startTestPOP3Server(t, box)
+	src := "pop3://bob:secret@" + addr
+	setupImportTest(t)
+	got := runEMailImport(src)
+	if len(got) != 2 || !strings.Contains(got[0], "first") || !strings.Contains(got[1], "second") {
+		t.Fatalf("first import got %q", got)
+	}
+	// uid-a is deleted on server and uid-c is new
+	box.set(append(msgs[1:], testMail("third", t1.Add(2*time.Hour))), []string{"uid-b", "uid-c"})
+	if got := runEMailImport(src); len(got) != 3 || !strings.Contains(got[2], "third") {
+		t.Fatalf("second import got %q", got)
+	}
+	if v := loadEMailSync("pop3://bob@" + addr + "/"); v != "uid-b\nuid-c" {
+		t.Errorf("saved UIDL %q", v)
+	}
+	// UIDL of message dropped by filter is not saved
+	defer func() { importFilter = nil }()
+	setupImportTest(t)
+	box.set(append(msgs, testMail("third", t1.Add(2*time.Hour))), []string{"uid-a", "uid-b", "uid-c"})
+	importFilter = regexp.MustCompile(`Subject: (first|third)`)
+	if got := runEMailImport(src); len(got) != 2 {
+		t.Fatalf("filtered import got %q", got)
+	}
+	if v := loadEMailSync("pop3://bob@" + addr + "/"); v != "uid-a\nuid-c" {
+		t.Errorf("saved UIDL after dropped message %q", v)
+	}
+	importFilter = nil
+	if got := runEMailImport(src); len(got) != 3 {
+		t.Fatalf("import after filter got %q", got)
+	}
+	if v := loadEMailSync("pop3://bob@" + addr + "/"); v != "uid-a\nuid-b\nuid-c" {
+		t.Errorf("saved UIDL after import %q", v)
+	}
+}
@@ -16,133 +16,206 @@ limitations under the License.
 package cmd
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
-	"io"
-	"log"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 )
 
 func importFromFile(path string) {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".zip":
-		imortFromZIPFile(path)
-		return
-	case ".evtx":
-		importFromWindowsEvtx(path)
-		return
-	case ".tgz":
-		importFormTarGZFile(path)
-		return
-	case ".gz":
-		if strings.HasSuffix(path, ".tar.gz") {
-			importFormTarGZFile(path)
-			return
-		}
-	}
 	r, err := os.Open(path)
 	if err != nil {
-		log.Panicln(err)
+		teaProg.Send(err)
+		return
 	}
 	defer r.Close()
-	if ext == ".gz" {
-		if gzr, err := gzip.NewReader(r); err == nil {
-			doImport(path, gzr)
-		}
-		return
+	if err := walkArchive(path, r, getSimpleFilter(filePat), importArchiveEnt); err != nil {
+		teaProg.Send(err)
 	}
-	doImport(path, r)
 }
 
-func imortFromZIPFile(path string) {
-	r, err := zip.OpenReader(path)
+var dirRecursive bool
+var dirIncludes []string
+var dirExcludes []string
+var dirNewer string
+var dirOlder string
+var dirFollowLinks bool
+
+var importWorkers int
+
+// importWorkersSet : --parallel is set on command line
+var importWorkersSet bool
+
+func importFromDir() {
+	files, err := getDirFiles(source)
 	if err != nil {
 		teaProg.Send(err)
 		return
 	}
-	defer r.Close()
-	filter := getSimpleFilter(filePat)
-	for _, f := range r.File {
-		p := filepath.Base(f.Name)
-		if filter != nil && !filter.MatchString(p) {
-			continue
-		}
-		r, err := f.Open()
-		if err != nil {
-			continue
-		}
-		ext := strings.ToLower(filepath.Ext(f.Name))
-		switch ext {
-		case ".gz":
-			if gzr, err := gzip.NewReader(r); err == nil {
-				doImport(path+":"+f.Name, gzr)
+	importFiles(files)
+}
+
+func getImportWorkers() int {
+	if importWorkers > 0 {
+		return importWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// importFiles : import files with workers.
+// Each file is imported by one worker, so Delta of logs is calculated in the file.
+func importFiles(files []string) {
+	n := min(getImportWorkers(), len(files))
+	if n < 2 {
+		for _, f := range files {
+			if stopImport {
+				return
 			}
-		case ".evtx":
-			w, err := os.CreateTemp("", "winlog*.evtx")
-			if err != nil {
-				log.Fatalln(err)
+			importFromFile(f)
+		}
+		return
+	}
+	ch := make(chan string)
+	var wg sync.WaitGroup
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for f := range ch {
+				teaProg.Send(ImportMsg{Path: f, Worker: w})
+				importFromFile(f)
 			}
-			defer os.Remove(w.Name())
-			io.Copy(w, r)
-			w.Close()
-			importFromWindowsEvtx(w.Name())
-		default:
-			doImport(path+":"+f.Name, r)
+			teaProg.Send(ImportMsg{Worker: w})
+		}(i)
+	}
+	for _, f := range files {
+		if stopImport {
+			break
 		}
+		ch <- f
 	}
+	close(ch)
+	wg.Wait()
 }
 
-func importFormTarGZFile(path string) {
-	r, err := os.Open(path)
-	if err != nil {
-		teaProg.Send(err)
-		return
+// dirFilter : conditions of files to import from directory
+type dirFilter struct {
+	includes []string
+	excludes []string
+	newer    int64
+	older    int64
+}
+
+func newDirFilter() (*dirFilter, error) {
+	f := &dirFilter{excludes: dirExcludes}
+	if filePat != "" {
+		f.includes = append(f.includes, filePat)
 	}
-	defer r.Close()
-	gzr, err := gzip.NewReader(r)
-	if err != nil {
-		teaProg.Send(err)
-		return
+	f.includes = append(f.includes, dirIncludes...)
+	if len(f.includes) < 1 {
+		f.includes = []string{"*"}
 	}
-	filter := getSimpleFilter(filePat)
-	tgzr := tar.NewReader(gzr)
-	for {
-		f, err := tgzr.Next()
-		if err != nil {
-			return
+	for _, p := range append(f.includes, f.excludes...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
 		}
-		if filter != nil && !filter.MatchString(f.Name) {
-			continue
+	}
+	var err error
+	if dirNewer != "" {
+		if f.newer, err = getBeforeTime(dirNewer); err != nil {
+			return nil, fmt.Errorf("invalid newer %s: %w", dirNewer, err)
 		}
-		if strings.HasSuffix(f.Name, ".gz") {
-			igzr, err := gzip.NewReader(tgzr)
-			if err != nil {
-				teaProg.Send(err)
-				return
-			}
-			doImport(path+":"+f.Name, igzr)
-		} else {
-			doImport(path+":"+f.Name, tgzr)
+	}
+	if dirOlder != "" {
+		if f.older, err = getBeforeTime(dirOlder); err != nil {
+			return nil, fmt.Errorf("invalid older %s: %w", dirOlder, err)
 		}
 	}
+	return f, nil
 }
 
-func importFromDir() {
-	pat := "*"
-	if filePat != "" {
-		pat = filePat
+// matchPattern : pattern with / is matched with relative path, otherwise with base name.
+func matchPattern(pats []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, p := range pats {
+		name := path.Base(rel)
+		if strings.Contains(p, "/") {
+			name = rel
+		}
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
 	}
-	files, err := filepath.Glob(filepath.Join(source, pat))
-	if err != nil {
-		teaProg.Send(err)
-		return
+	return false
+}
+
+func (f *dirFilter) matchFile(rel string, fi os.FileInfo) bool {
+	if !matchPattern(f.includes, rel) || matchPattern(f.excludes, rel) {
+		return false
 	}
-	for _, f := range files {
-		importFromFile(f)
+	t := fi.ModTime().UnixNano()
+	if f.newer > 0 && t < f.newer {
+		return false
 	}
+	if f.older > 0 && t > f.older {
+		return false
+	}
+	return true
+}
 
+// getDirFiles : get files to import from dir.
+// Subdirectories are searched with --recursive, and symbolic links to directories are followed with --followLinks.
+func getDirFiles(dir string) ([]string, error) {
+	f, err := newDirFilter()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	visited := make(map[string]bool)
+	var walk func(d, rel string) error
+	walk = func(d, rel string) error {
+		if real, err := filepath.EvalSymlinks(d); err == nil {
+			if visited[real] {
+				return nil
+			}
+			visited[real] = true
+		}
+		ents, err := os.ReadDir(d)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			p := filepath.Join(d, e.Name())
+			r := filepath.Join(rel, e.Name())
+			isLink := e.Type()&fs.ModeSymlink != 0
+			fi, err := os.Stat(p)
+			if err != nil {
+				// broken link
+				continue
+			}
+			if fi.IsDir() {
+				if !dirRecursive || (isLink && !dirFollowLinks) || matchPattern(f.excludes, r) {
+					continue
+				}
+				if err := walk(p, r); err != nil {
+					return err
+				}
+				continue
+			}
+			if fi.Mode().IsRegular() && f.matchFile(r, fi) {
+				files = append(files, p)
+			}
+		}
+		return nil
+	}
+	if err := walk(dir, ""); err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
 }
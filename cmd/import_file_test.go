@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestGetDirFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	files := map[string]time.Time{
+		"messages":               time.Now(),
+		"app.log":                time.Now(),
+		"old.log":                old,
+		"nginx/access.log":       time.Now(),
+		"nginx/error.log":        time.Now(),
+		"archive/2024/a.log":     time.Now(),
+		"linked/target/link.log": time.Now(),
+	}
+	for p, mt := range files {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "linked", "target"), filepath.Join(dir, "nginx", "sub")); err != nil {
+		t.Skip(err)
+	}
+	// loop
+	if err := os.Symlink(dir, filepath.Join(dir, "nginx", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	reset := func() {
+		filePat = ""
+		dirRecursive = false
+		dirIncludes = nil
+		dirExcludes = nil
+		dirNewer = ""
+		dirOlder = ""
+		dirFollowLinks = false
+	}
+	defer reset()
+	tests := []struct {
+		name  string
+		setup func()
+		want  []string
+	}{
+		{"default", func() {}, []string{"app.log", "messages", "old.log"}},
+		{"filePat", func() { filePat = "*.log" }, []string{"app.log", "old.log"}},
+		{"recursive", func() {
+			dirRecursive = true
+			dirIncludes = []string{"*.log"}
+			dirExcludes = []string{"archive", "error.*"}
+		}, []string{"app.log", "linked/target/link.log", "nginx/access.log", "old.log"}},
+		{"path pattern", func() {
+			dirRecursive = true
+			dirIncludes = []string{"nginx/*"}
+		}, []string{"nginx/access.log", "nginx/error.log"}},
+		{"newer", func() {
+			dirRecursive = true
+			dirExcludes = []string{"linked", "archive", "nginx"}
+			dirNewer = "24h"
+		}, []string{"app.log", "messages"}},
+		{"older", func() { dirOlder = "24h" }, []string{"old.log"}},
+		{"followLinks", func() {
+			dirRecursive = true
+			dirFollowLinks = true
+			dirIncludes = []string{"*.log"}
+			dirExcludes = []string{"archive", "linked"}
+		}, []string{"app.log", "nginx/access.log", "nginx/error.log", "nginx/sub/link.log", "old.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			tt.setup()
+			got, err := getDirFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i], _ = filepath.Rel(dir, got[i])
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDirFiles got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	dir := t.TempDir()
+	setupImportTest(t)
+	files := []string{}
+	for i := 0; i < 8; i++ {
+		lines := []string{}
+		for j := 0; j < 50; j++ {
+			lines = append(lines, fmt.Sprintf("2024-05-%02dT10:%02d:00Z host%d app: log %d", i+1, j, i, j))
+		}
+		// one log goes back in each file
+		lines[25] = fmt.Sprintf("2024-05-%02dT09:00:00Z host%d app: late", i+1, i)
+		p := filepath.Join(dir, fmt.Sprintf("app%d.log", i))
+		if i%2 == 0 {
+			p += ".gz"
+			f, err := os.Create(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := gzip.NewWriter(f)
+			w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+			w.Close()
+			f.Close()
+		} else if err := os.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, p)
+	}
+	old := importWorkers
+	defer func() { importWorkers = old }()
+	importWorkers = 4
+	n := len(runImportTest(func() { importFiles(files) }))
+	if files, lines, _ := getImportTotal(); files != 8 || lines != 400 {
+		t.Errorf("total files=%d lines=%d, want 8 400", files, lines)
+	}
+	delta := 0
+	db.View(func(tx *bbolt.Tx) error {
+		delta = tx.Bucket([]byte("delta")).Stats().KeyN
+		return nil
+	})
+	if n != 400 {
+		t.Errorf("logs got %d, want 400", n)
+	}
+	// Delta is negative only for the late log of each file
+	if delta != 8 {
+		t.Errorf("negative delta got %d, want 8", delta)
+	}
+	if s := len(getSources()); s != 8 {
+		t.Errorf("sources got %d, want 8", s)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Follow mode
+//
+// Each followed file has its own goroutine.
+// followMu is held while importing lines and released while waiting for new lines,
+// so that only one goroutine uses timegrinder and counters at once.
+
+var followMode bool
+var flushInterval int
+
+var followMu sync.Mutex
+var followWg sync.WaitGroup
+
+const followPollInterval = 500 * time.Millisecond
+const followDirInterval = 2 * time.Second
+
+// tailReader : reader of followed file that waits for appended data.
+// It returns io.EOF when the file is rotated or truncated, or import is stopped.
+type tailReader struct {
+	f      *os.File
+	path   string
+	fi     os.FileInfo
+	offset int64
+	// wait is called when reader starts waiting for new data
+	wait func()
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	followMu.Unlock()
+	defer followMu.Lock()
+	waiting := false
+	for !stopImport {
+		n, err := t.f.Read(p)
+		if n > 0 {
+			t.offset += int64(n)
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if t.rotated() {
+			return 0, io.EOF
+		}
+		if !waiting && t.wait != nil {
+			t.wait()
+		}
+		waiting = true
+		time.Sleep(followPollInterval)
+	}
+	return 0, io.EOF
+}
+
+// rotated : check path is renamed, removed or truncated
+func (t *tailReader) rotated() bool {
+	fi, err := os.Stat(t.path)
+	if err != nil || !os.SameFile(fi, t.fi) {
+		return true
+	}
+	return fi.Size() < t.offset
+}
+
+// canFollow : check the file is plain text log
+func canFollow(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip", ".evtx", ".tgz", ".gz", ".tar", ".bz2", ".xz", ".zst", ".eml", ".journal", ".journal~", ".pcap", ".pcapng", ".cap":
+		return false
+	}
+	return true
+}
+
+// followSleep : sleep without holding followMu
+func followSleep(d time.Duration) {
+	followMu.Unlock()
+	time.Sleep(d)
+	followMu.Lock()
+}
+
+func startFollowFile(path string) {
+	followWg.Add(1)
+	go func() {
+		defer followWg.Done()
+		followFile(path, true)
+	}()
+}
+
+func startFollowDir(dir string) {
+	followWg.Add(1)
+	go func() {
+		defer followWg.Done()
+		followDir(dir)
+	}()
+}
+
+// followFile : import lines appended to file until import is stopped.
+// When the file is rotated or truncated, the new file of the path is imported if reopen is true.
+func followFile(path string, reopen bool) {
+	followMu.Lock()
+	defer followMu.Unlock()
+	for !stopImport {
+		f, fi := openFollowFile(path, reopen)
+		if f == nil {
+			return
+		}
+		head := make([]byte, min(fi.Size(), fpSize))
+		n, _ := f.ReadAt(head, 0)
+		tr := &tailReader{f: f, path: path, fi: fi}
+		importLines(path, bufio.NewReaderSize(tr, 64*1024), head[:n], tr)
+		f.Close()
+		if !reopen {
+			return
+		}
+	}
+}
+
+// openFollowFile : wait until the file has some data and open it.
+// Returns nil when import is stopped or the file does not exist and reopen is false.
+func openFollowFile(path string, reopen bool) (*os.File, os.FileInfo) {
+	for !stopImport {
+		f, err := os.Open(path)
+		if err != nil {
+			if !reopen {
+				return nil, nil
+			}
+		} else {
+			if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+				return f, fi
+			}
+			f.Close()
+		}
+		followSleep(followPollInterval)
+	}
+	return nil, nil
+}
+
+// followDir : follow files matching pattern in dir.
+// New files are found by polling and files that can not be followed are imported once.
+func followDir(dir string) {
+	active := make(map[string]os.FileInfo)
+	imported := make(map[string]bool)
+	followMu.Lock()
+	defer followMu.Unlock()
+	for !stopImport {
+		files, err := getDirFiles(dir)
+		if err != nil {
+			teaProg.Send(err)
+			return
+		}
+		for _, p := range files {
+			fi, err := os.Stat(p)
+			if err != nil || fi.IsDir() || isFollowing(active, p, fi) {
+				continue
+			}
+			if !canFollow(p) {
+				if !imported[p] {
+					imported[p] = true
+					importFromFile(p)
+				}
+				continue
+			}
+			active[p] = fi
+			followWg.Add(1)
+			go func(p string) {
+				defer followWg.Done()
+				followFile(p, false)
+				followMu.Lock()
+				delete(active, p)
+				followMu.Unlock()
+			}(p)
+		}
+		followSleep(followDirInterval)
+	}
+}
+
+// isFollowing : check the file is followed by the path or by the old name before rename
+func isFollowing(active map[string]os.FileInfo, path string, fi os.FileInfo) bool {
+	if _, ok := active[path]; ok {
+		return true
+	}
+	for _, afi := range active {
+		if os.SameFile(afi, fi) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStreamImport : check sources keep sending logs until stopped
+func isStreamImport() bool {
+	if followMode {
+		return true
+	}
+	for _, s := range sources {
+		if strings.HasPrefix(s, "syslog:") || strings.HasPrefix(s, "syslog+") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTailReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate func(path string) error
+	}{
+		{"truncate", func(path string) error {
+			return os.Truncate(path, 0)
+		}},
+		{"rename", func(path string) error {
+			if err := os.Rename(path, path+".1"); err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte("new\n"), 0644)
+		}},
+		{"remove", func(path string) error {
+			return os.Remove(path)
+		}},
+	}
+	stopImport = false
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.log")
+			if err := os.WriteFile(path, []byte("line1\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			waits := 0
+			tr := &tailReader{f: f, path: path, fi: fi, wait: func() { waits++ }}
+			errCh := make(chan error, 1)
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				w, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				w.WriteString("line2\n")
+				w.Close()
+				time.Sleep(2 * followPollInterval)
+				errCh <- tt.rotate(path)
+			}()
+			followMu.Lock()
+			b, err := io.ReadAll(tr)
+			followMu.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errCh; err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "line1\nline2\n" {
+				t.Errorf("read %q", string(b))
+			}
+			if waits < 1 {
+				t.Error("wait is not called")
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v3"
+)
+
+// SSH inventory
+//
+// Inventory file has hosts to collect logs by SSH. Files and output of
+// commands of hosts are imported in parallel by --parallel workers, and
+// each log has the tag of host like "host=web1 ".
+//
+//	parallel: 4
+//	defaults:
+//	  user: admin
+//	  agent: true
+//	  knownHosts: ~/.ssh/known_hosts
+//	hosts:
+//	  - name: web1
+//	    host: 192.168.1.10
+//	    files: [/var/log/messages, /var/log/nginx/*.log]
+//	  - host: 192.168.1.11
+//	    key: ~/.ssh/id_ed25519
+//	    commands: ["journalctl -n 10000 --no-pager"]
+
+var inventoryFile string
+var knownHostsFile string
+var sshAgent bool
+
+type inventoryHost struct {
+	Name       string   `yaml:"name"`
+	Host       string   `yaml:"host"`
+	Port       int      `yaml:"port"`
+	User       string   `yaml:"user"`
+	Password   string   `yaml:"password"`
+	Key        string   `yaml:"key"`
+	Passphrase string   `yaml:"passphrase"`
+	Agent      bool     `yaml:"agent"`
+	KnownHosts string   `yaml:"knownHosts"`
+	Insecure   bool     `yaml:"insecure"`
+	Files      []string `yaml:"files"`
+	Commands   []string `yaml:"commands"`
+}
+
+type inventory struct {
+	Parallel int             `yaml:"parallel"`
+	Defaults inventoryHost   `yaml:"defaults"`
+	Hosts    []inventoryHost `yaml:"hosts"`
+}
+
+var inventoryHosts []inventoryHost
+
+// hostTags : names of inventory hosts. Path of log from host is name:path.
+var hostTags sync.Map
+
+// loadInventory : load --inventory file and apply defaults to hosts
+func loadInventory() error {
+	if inventoryFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(inventoryFile)
+	if err != nil {
+		return err
+	}
+	var inv inventory
+	if err := yaml.Unmarshal(b, &inv); err != nil {
+		return fmt.Errorf("%s: %w", inventoryFile, err)
+	}
+	d := inv.Defaults
+	names := make(map[string]bool)
+	inventoryHosts = []inventoryHost{}
+	for _, h := range inv.Hosts {
+		if h.Host == "" {
+			return fmt.Errorf("%s: host is required", inventoryFile)
+		}
+		if h.Name == "" {
+			h.Name = h.Host
+		}
+		if names[h.Name] {
+			return fmt.Errorf("%s: duplicate host %s", inventoryFile, h.Name)
+		}
+		names[h.Name] = true
+		if h.Port == 0 {
+			h.Port = d.Port
+		}
+		if h.User == "" {
+			h.User = d.User
+		}
+		if h.Password == "" {
+			h.Password = d.Password
+		}
+		if h.Key == "" {
+			h.Key = d.Key
+		}
+		if h.Passphrase == "" {
+			h.Passphrase = d.Passphrase
+		}
+		if h.KnownHosts == "" {
+			h.KnownHosts = d.KnownHosts
+		}
+		h.Agent = h.Agent || d.Agent
+		h.Insecure = h.Insecure || d.Insecure
+		if len(h.Files) < 1 && len(h.Commands) < 1 {
+			h.Files = d.Files
+			h.Commands = d.Commands
+		}
+		inventoryHosts = append(inventoryHosts, h)
+	}
+	// --parallel on command line is used rather than the file
+	if inv.Parallel > 0 && !importWorkersSet {
+		importWorkers = inv.Parallel
+	}
+	return nil
+}
+
+// importInventory : import logs of inventory hosts with workers
+func importInventory() {
+	n := min(getImportWorkers(), len(inventoryHosts))
+	ch := make(chan *inventoryHost)
+	var wg sync.WaitGroup
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for h := range ch {
+				if n > 1 {
+					teaProg.Send(ImportMsg{Path: h.Name, Worker: w})
+				}
+				if err := importFromHost(h); err != nil {
+					teaProg.Send(fmt.Errorf("%s: %w", h.Name, err))
+				}
+			}
+			if n > 1 {
+				teaProg.Send(ImportMsg{Worker: w})
+			}
+		}(i)
+	}
+	for i := range inventoryHosts {
+		if stopImport {
+			break
+		}
+		ch <- &inventoryHosts[i]
+	}
+	close(ch)
+	wg.Wait()
+}
+
+func importFromHost(h *inventoryHost) error {
+	config, closer, err := getSSHClientConfig(h)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	port := h.Port
+	if port == 0 {
+		port = 22
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(h.Host, strconv.Itoa(port)), config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	hostTags.Store(h.Name, true)
+	for _, f := range h.Files {
+		files := []string{f}
+		if strings.ContainsAny(f, "*?[") {
+			// Remote shell expands the pattern
+			out, err := runSSHCommand(client, "ls -1d -- "+f)
+			if err != nil {
+				// Other files are imported
+				teaProg.Send(fmt.Errorf("%s:%s: %w", h.Name, f, err))
+				continue
+			}
+			files = []string{}
+			for _, l := range strings.Split(string(out), "\n") {
+				if l != "" {
+					files = append(files, l)
+				}
+			}
+		}
+		for _, file := range files {
+			if stopImport {
+				return nil
+			}
+			// File that can not be read is not recorded as source
+			if _, err := runSSHCommand(client, "test -r "+shellQuote(file)); err != nil {
+				teaProg.Send(fmt.Errorf("%s:%s: can not read file", h.Name, file))
+				continue
+			}
+			if err := importSSHOutput(client, h.Name+":"+file, "cat -- "+shellQuote(file)); err != nil {
+				teaProg.Send(err)
+			}
+		}
+	}
+	for _, c := range h.Commands {
+		if stopImport {
+			return nil
+		}
+		if err := importSSHOutput(client, h.Name+":"+c, c); err != nil {
+			teaProg.Send(err)
+		}
+	}
+	return nil
+}
+
+func runSSHCommand(client *ssh.Client, cmd string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return session.Output(cmd)
+}
+
+// importSSHOutput : import output of command. Compressed file and archive are also imported.
+func importSSHOutput(client *ssh.Client, path, cmd string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	err = walkArchive(path, r, nil, importArchiveEnt)
+	if stopImport {
+		return err
+	}
+	// Read rest of output to finish command
+	io.Copy(io.Discard, r)
+	if werr := session.Wait(); werr != nil && err == nil {
+		err = fmt.Errorf("%s: %w", path, werr)
+	}
+	return err
+}
+
+// getSSHClientConfig : auth by password, key and ssh-agent and check host key by known_hosts.
+// Closer is the connection to ssh-agent.
+func getSSHClientConfig(h *inventoryHost) (*ssh.ClientConfig, io.Closer, error) {
+	config := &ssh.ClientConfig{
+		User:    h.User,
+		Timeout: 60 * time.Second,
+	}
+	var closer io.Closer
+	if h.Agent || sshAgent {
+		conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("ssh-agent: %w", err)
+		}
+		closer = conn
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	key := h.Key
+	if key == "" {
+		key = sshKey
+	}
+	if key == "" && len(config.Auth) < 1 && h.Password == "" {
+		key = "~/.ssh/id_rsa"
+	}
+	if key != "" {
+		signer, err := getSSHSigner(expandHome(key), h.Passphrase)
+		if err != nil {
+			if closer != nil {
+				closer.Close()
+			}
+			return nil, nil, err
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if h.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(h.Password))
+	}
+	if h.Insecure {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return config, closer, nil
+	}
+	kh := h.KnownHosts
+	if kh == "" {
+		kh = knownHostsFile
+	}
+	if kh == "" {
+		kh = "~/.ssh/known_hosts"
+	}
+	cb, err := knownhosts.New(expandHome(kh))
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, nil, err
+	}
+	config.HostKeyCallback = cb
+	return config, closer, nil
+}
+
+func getSSHSigner(path, passphrase string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(b)
+}
+
+// setSSHOptions : add ssh-agent and known_hosts check of --sshAgent and --knownHosts
+// to config of ssh and scp source.
+func setSSHOptions(config *ssh.ClientConfig) (io.Closer, error) {
+	var closer io.Closer
+	if sshAgent {
+		conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, fmt.Errorf("ssh-agent: %w", err)
+		}
+		closer = conn
+		config.Auth = append([]ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, config.Auth...)
+	}
+	if knownHostsFile != "" {
+		cb, err := knownhosts.New(expandHome(knownHostsFile))
+		if err != nil {
+			if closer != nil {
+				closer.Close()
+			}
+			return nil, err
+		}
+		config.HostKeyCallback = cb
+	}
+	return closer, nil
+}
+
+func expandHome(p string) string {
+	if strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[2:])
+		}
+	}
+	return p
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// getHostTag : get tag of inventory host from path like web1:/var/log/messages
+func getHostTag(path string) (string, string) {
+	name, _, ok := strings.Cut(path, ":")
+	if !ok {
+		return "", ""
+	}
+	if _, ok := hostTags.Load(name); !ok {
+		return "", ""
+	}
+	return name, "host=" + name + " "
+}
+
+// trimHostTag : remove tag of host from log
+func trimHostTag(l string) string {
+	if strings.HasPrefix(l, "host=") {
+		if _, r, ok := strings.Cut(l, " "); ok {
+			return r
+		}
+	}
+	return l
+}
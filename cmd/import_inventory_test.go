@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startTestSSHServer : SSH server that runs exec request by sh and accepts the key
+func startTestSSHServer(t *testing.T, dir string, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hk, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "admin" && string(k.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					ch, reqs, err := nc.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						defer ch.Close()
+						for req := range reqs {
+							if req.Type != "exec" {
+								req.Reply(false, nil)
+								continue
+							}
+							var p struct{ Command string }
+							ssh.Unmarshal(req.Payload, &p)
+							req.Reply(true, nil)
+							c := exec.Command("sh", "-c", p.Command)
+							c.Dir = dir
+							c.Stdout = ch
+							c.Stderr = ch.Stderr()
+							status := struct{ Status uint32 }{}
+							if err := c.Run(); err != nil {
+								status.Status = 1
+							}
+							ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+							return
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestImportInventory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh and unix socket are required")
+	}
+	defer func() {
+		inventoryFile, knownHostsFile, sshKey, sshAgent = "", "", "", false
+		inventoryHosts = nil
+		importWorkers = 1
+	}()
+	tmp := t.TempDir()
+	// remote files
+	dir := filepath.Join(tmp, "remote")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "a.log"), []byte("2024-05-01T10:00:00Z sshd accepted\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.log.gz"), testGzip(t, []byte("2024-05-01T10:00:01Z cron run\n")), 0o644)
+	os.WriteFile(filepath.Join(dir, "c d.log.gz"), testGzip(t, []byte("2024-05-01T10:00:02Z cron done\n")), 0o644)
+	os.WriteFile(filepath.Join(dir, "fw.csv"), []byte("time,src,action\n2024-05-01T10:00:03Z,192.168.1.5,deny\n"), 0o644)
+	// client key file and ssh-agent with the same key
+	_, ck, _ := ed25519.GenerateKey(rand.Reader)
+	b, err := ssh.MarshalPrivateKey(ck, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(tmp, "id_ed25519")
+	os.WriteFile(keyFile, pem.EncodeToMemory(b), 0o600)
+	signer, _ := ssh.NewSignerFromKey(ck)
+	keyring := agent.NewKeyring()
+	keyring.Add(agent.AddedKey{PrivateKey: ck})
+	sock := filepath.Join(tmp, "agent.sock")
+	al, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	go func() {
+		for {
+			c, err := al.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, c)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	addr, hostKey := startTestSSHServer(t, dir, signer.PublicKey())
+	host, port, _ := net.SplitHostPort(addr)
+	knownHosts := filepath.Join(tmp, "known_hosts")
+	os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)+"\n"), 0o600)
+
+	inventoryFile = filepath.Join(tmp, "hosts.yaml")
+	os.WriteFile(inventoryFile, []byte(fmt.Sprintf(`parallel: 2
+defaults:
+  user: admin
+  port: %s
+  knownHosts: %s
+hosts:
+  - name: web1
+    host: %s
+    key: %s
+    files: [none.log, "none*.log", a.log, "*.gz"]
+  - name: web2
+    host: %s
+    agent: true
+    files: [fw.csv]
+`, port, knownHosts, host, keyFile, host)), 0o600)
+	importWorkers = 1
+	if err := loadInventory(); err != nil {
+		t.Fatal(err)
+	}
+	if importWorkers != 2 || len(inventoryHosts) != 2 || inventoryHosts[1].User != "admin" {
+		t.Fatalf("invalid inventory %d %+v", importWorkers, inventoryHosts)
+	}
+	// --parallel 1 is not overridden by the file
+	importWorkers, importWorkersSet = 1, true
+	inventoryHosts = nil
+	err = loadInventory()
+	importWorkersSet = false
+	if err != nil || importWorkers != 1 {
+		t.Errorf("--parallel 1 is overridden %d %v", importWorkers, err)
+	}
+
+	setupImportTest(t)
+	got := runImportTest(importInventory)
+	srcs := []string{}
+	var src string
+	db.View(func(tx *bbolt.Tx) error {
+		cols := getColumnMap(tx)
+		scanLogs(tx, 0, 1<<62, func(ti int64, k, v []byte) bool {
+			if s, ok := cols.value(k, string(v), "src"); ok {
+				src = s
+			}
+			return true
+		})
+		tx.Bucket([]byte("sources")).ForEach(func(k, v []byte) error {
+			srcs = append(srcs, string(v))
+			return nil
+		})
+		return nil
+	})
+	sort.Strings(got)
+	want := []string{
+		"host=web1 2024-05-01T10:00:00Z sshd accepted",
+		"host=web1 2024-05-01T10:00:01Z cron run",
+		"host=web1 2024-05-01T10:00:02Z cron done",
+		"host=web2 2024-05-01T10:00:03Z,192.168.1.5,deny",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if src != "192.168.1.5" {
+		t.Errorf("column src = %q", src)
+	}
+	if len(srcs) != 4 || !strings.Contains(strings.Join(srcs, ""), `"Path":"web1:c d.log.gz","Type":"ssh"`) {
+		t.Errorf("sources %q", srcs)
+	}
+
+	// host key is verified by known_hosts
+	os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr)}, signer.PublicKey())+"\n"), 0o600)
+	if err := importFromHost(&inventoryHosts[0]); err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Errorf("host key mismatch is not detected %v", err)
+	}
+}
+
+func TestHostTagFields(t *testing.T) {
+	defer resetProfile()
+	resetProfile()
+	hostTags.Store("web3", true)
+	defer hostTags.Delete("web3")
+	setupImportTest(t)
+	fieldsMode, grokPat = "grok", `^%{TIMESTAMP_ISO8601:time} %{IP:client} %{WORD:method}`
+	if err := setupFields(); err != nil {
+		t.Fatal(err)
+	}
+	jsonTime = "ts"
+	got := runImportTest(func() {
+		doImport("web3:access.log", strings.NewReader("2024-10-10T12:00:00Z 192.168.1.5 GET /index.html\n"))
+		doImport("web3:events.json", strings.NewReader(`{"ts":"2024-10-10T12:00:01Z","msg":"hello"}`))
+	})
+	want := []string{
+		"host=web3 2024-10-10T12:00:00Z 192.168.1.5 GET /index.html",
+		`host=web3 {"msg":"hello","ts":"2024-10-10T12:00:01Z"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Fields are extracted from log without the tag
+	db.View(func(tx *bbolt.Tx) error {
+		fb := getFieldBucket(tx, "grok", "client")
+		if fb == nil {
+			t.Error("no client field")
+			return nil
+		}
+		scanLogs(tx, 0, 1<<62, func(ti int64, k, v []byte) bool {
+			if strings.Contains(string(v), "GET") {
+				if c, _ := getField(fb, "grok", "client", k, v); c != "192.168.1.5" {
+					t.Errorf("stored client = %q", c)
+				}
+				if c, _ := getField(nil, "grok", "client", k, v); c != "192.168.1.5" {
+					t.Errorf("client = %q", c)
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	srcs := getSources()
+	if len(srcs) != 2 {
+		t.Fatalf("sources %d", len(srcs))
+	}
+	for _, s := range srcs {
+		if s.Host != "web3" || s.Type != "ssh" {
+			t.Errorf("source %s host=%q type=%q", s.Path, s.Host, s.Type)
+		}
+	}
+}
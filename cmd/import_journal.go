@@ -0,0 +1,426 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// systemd journal
+//
+// Entries of binary journal file and journalctl -o export / -o json streams are
+// converted to lines of "time host severity:facility unit tag message".
+// The time is __REALTIME_TIMESTAMP of entry.
+
+// addJournal : import journal entry. Returns false when import is stopped.
+func addJournal(e *entryImport, fields map[string]string) bool {
+	t, l, ok := journalToLog(fields)
+	if !ok {
+		return e.skip()
+	}
+	return e.add(t, l)
+}
+
+// journalToLog : make log line from fields of journal entry
+func journalToLog(fields map[string]string) (int64, string, bool) {
+	us, err := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	t := us * 1000
+	sv, fac := -1, -1
+	if v, err := strconv.Atoi(fields["PRIORITY"]); err == nil {
+		sv = v
+	}
+	if v, err := strconv.Atoi(fields["SYSLOG_FACILITY"]); err == nil {
+		fac = v
+	}
+	host := journalField(fields, "_HOSTNAME")
+	unit := journalField(fields, "_SYSTEMD_UNIT", "_SYSTEMD_USER_UNIT", "UNIT")
+	tag := journalField(fields, "SYSLOG_IDENTIFIER", "_COMM")
+	if pid := journalField(fields, "SYSLOG_PID", "_PID"); pid != "-" {
+		tag += "[" + pid + "]"
+	}
+	msg := strings.TrimRight(fields["MESSAGE"], "\r\n")
+	return t, fmt.Sprintf("%s %s %s %s %s %s", time.Unix(0, t).Format(time.RFC3339Nano), host, getSyslogType(sv, fac), unit, tag, msg), true
+}
+
+// journalField : get first field that has value or "-"
+func journalField(fields map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := fields[k]; v != "" {
+			return v
+		}
+	}
+	return "-"
+}
+
+// getJournalFormat : check head of stream is journalctl -o export or -o json
+func getJournalFormat(head []byte) string {
+	l := head
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		l = head[:i]
+	}
+	if bytes.HasPrefix(l, []byte("__CURSOR=")) || bytes.HasPrefix(l, []byte("__REALTIME_TIMESTAMP=")) {
+		return "export"
+	}
+	if bytes.HasPrefix(l, []byte("{")) && bytes.Contains(l, []byte(`"__REALTIME_TIMESTAMP"`)) {
+		return "json"
+	}
+	return ""
+}
+
+func importJournalExport(path string, r *bufio.Reader) error {
+	e := newEntryImport(path)
+	if err := readJournalExport(r, func(f map[string]string) bool { return addJournal(e, f) }); err != nil {
+		return err
+	}
+	e.done()
+	return nil
+}
+
+func importJournalJSON(path string, r *bufio.Reader) error {
+	e := newEntryImport(path)
+	if err := readJournalJSON(r, func(f map[string]string) bool { return addJournal(e, f) }); err != nil {
+		return err
+	}
+	e.done()
+	return nil
+}
+
+// importFromJournalFile : import binary journal. file is the local file of path.
+func importFromJournalFile(path, file string) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	e := newEntryImport(path)
+	if err := readJournalFile(r, func(f map[string]string) bool { return addJournal(e, f) }); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	e.done()
+	return nil
+}
+
+// readJournalExport : read entries of journal export format.
+// Entries are separated by empty line. Binary field is name, 64bit length and data.
+func readJournalExport(r *bufio.Reader, fn func(map[string]string) bool) error {
+	fields := make(map[string]string)
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		l = strings.TrimSuffix(l, "\n")
+		if l == "" {
+			if len(fields) > 0 {
+				if !fn(fields) {
+					return nil
+				}
+				fields = make(map[string]string)
+			}
+			if err == io.EOF {
+				return nil
+			}
+			continue
+		}
+		if k, v, ok := strings.Cut(l, "="); ok {
+			fields[k] = v
+		} else if err == nil {
+			var n uint64
+			if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+				return err
+			}
+			if n > 64*1024*1024 {
+				return errors.New("invalid journal export binary field")
+			}
+			v := make([]byte, n+1)
+			if _, err := io.ReadFull(r, v); err != nil {
+				return err
+			}
+			fields[l] = string(v[:n])
+		}
+		if err == io.EOF {
+			if len(fields) > 0 {
+				fn(fields)
+			}
+			return nil
+		}
+	}
+}
+
+// readJournalJSON : read entries of journalctl -o json.
+// Binary field is array of numbers and multiple values are array of strings.
+func readJournalJSON(r *bufio.Reader, fn func(map[string]string) bool) error {
+	for {
+		l, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(l)) > 0 {
+			var m map[string]any
+			if json.Unmarshal(l, &m) != nil {
+				m = map[string]any{}
+			}
+			fields := make(map[string]string)
+			for k, v := range m {
+				if s, ok := journalJSONValue(v); ok {
+					fields[k] = s
+				}
+			}
+			if !fn(fields) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func journalJSONValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case []any:
+		b := []byte{}
+		for _, e := range v {
+			switch e := e.(type) {
+			case string:
+				// First value of field with multiple values
+				return e, true
+			case float64:
+				b = append(b, byte(e))
+			}
+		}
+		return string(b), true
+	}
+	return "", false
+}
+
+// Binary journal file
+// https://systemd.io/JOURNAL_FILE_FORMAT/
+
+const (
+	journalObjectData  = 1
+	journalObjectEntry = 3
+
+	journalCompressedXZ   = 1
+	journalCompressedLZ4  = 2
+	journalCompressedZSTD = 4
+
+	journalIncompatibleCompact = 16
+)
+
+type journalFile struct {
+	r       io.ReaderAt
+	compact bool
+	cache   map[uint64][]byte
+}
+
+// readJournalFile : read entry objects of journal file in the order of objects
+func readJournalFile(r io.ReaderAt, fn func(map[string]string) bool) error {
+	h := make([]byte, 160)
+	if _, err := r.ReadAt(h, 0); err != nil {
+		return err
+	}
+	if string(h[:8]) != "LPKSHHRH" {
+		return errors.New("invalid journal file")
+	}
+	le := binary.LittleEndian
+	jf := &journalFile{
+		r:       r,
+		compact: le.Uint32(h[12:])&journalIncompatibleCompact != 0,
+		cache:   make(map[uint64][]byte),
+	}
+	tail := le.Uint64(h[136:])
+	oh := make([]byte, 16)
+	for off := le.Uint64(h[88:]); off > 0 && off <= tail; {
+		if _, err := r.ReadAt(oh, int64(off)); err != nil {
+			return err
+		}
+		size := le.Uint64(oh[8:])
+		if size < 16 {
+			return errors.New("invalid journal object")
+		}
+		if oh[0] == journalObjectEntry {
+			fields, err := jf.readEntry(off, size)
+			if err != nil {
+				return err
+			}
+			if !fn(fields) {
+				return nil
+			}
+		}
+		off += (size + 7) &^ 7
+	}
+	return nil
+}
+
+// readEntry : read realtime and data objects of entry
+func (jf *journalFile) readEntry(off, size uint64) (map[string]string, error) {
+	b := make([]byte, size)
+	if _, err := jf.r.ReadAt(b, int64(off)); err != nil {
+		return nil, err
+	}
+	if size < 64 {
+		return nil, errors.New("invalid journal entry")
+	}
+	le := binary.LittleEndian
+	fields := map[string]string{
+		"__REALTIME_TIMESTAMP": strconv.FormatUint(le.Uint64(b[24:]), 10),
+	}
+	step := 16
+	if jf.compact {
+		step = 4
+	}
+	for i := 64; i+step <= len(b); i += step {
+		var doff uint64
+		if jf.compact {
+			doff = uint64(le.Uint32(b[i:]))
+		} else {
+			doff = le.Uint64(b[i:])
+		}
+		d, err := jf.readData(doff)
+		if err != nil {
+			return nil, err
+		}
+		if k, v, ok := bytes.Cut(d, []byte("=")); ok {
+			if _, ok := fields[string(k)]; !ok {
+				fields[string(k)] = string(v)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// readData : read payload of data object
+func (jf *journalFile) readData(off uint64) ([]byte, error) {
+	if d, ok := jf.cache[off]; ok {
+		return d, nil
+	}
+	oh := make([]byte, 16)
+	if _, err := jf.r.ReadAt(oh, int64(off)); err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	size := le.Uint64(oh[8:])
+	start := uint64(64)
+	if jf.compact {
+		start = 72
+	}
+	if oh[0] != journalObjectData || size < start || size > 64*1024*1024 {
+		return nil, errors.New("invalid journal data object")
+	}
+	b := make([]byte, size)
+	if _, err := jf.r.ReadAt(b, int64(off)); err != nil {
+		return nil, err
+	}
+	d := b[start:]
+	var err error
+	switch {
+	case oh[1]&journalCompressedXZ != 0:
+		var xr *xz.Reader
+		if xr, err = xz.NewReader(bytes.NewReader(d)); err == nil {
+			d, err = io.ReadAll(xr)
+		}
+	case oh[1]&journalCompressedLZ4 != 0:
+		if len(d) < 8 {
+			return nil, errors.New("invalid journal lz4 data")
+		}
+		d, err = decodeLZ4Block(d[8:], int(le.Uint64(d)))
+	case oh[1]&journalCompressedZSTD != 0:
+		setupZstd()
+		d, err = zstdDec.DecodeAll(d, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(jf.cache) > 10000 {
+		jf.cache = make(map[uint64][]byte)
+	}
+	jf.cache[off] = d
+	return d, nil
+}
+
+// decodeLZ4Block : decode LZ4 block format
+func decodeLZ4Block(src []byte, size int) ([]byte, error) {
+	errInvalid := errors.New("invalid lz4 block")
+	dst := make([]byte, 0, size)
+	readLen := func(i, n int) (int, int, error) {
+		if n < 15 {
+			return i, n, nil
+		}
+		for {
+			if i >= len(src) {
+				return i, n, errInvalid
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, nil
+			}
+		}
+	}
+	i, n := 0, 0
+	var err error
+	for i < len(src) {
+		token := src[i]
+		i++
+		i, n, err = readLen(i, int(token>>4))
+		if err != nil || i+n > len(src) {
+			return nil, errInvalid
+		}
+		dst = append(dst, src[i:i+n]...)
+		i += n
+		if i >= len(src) {
+			break
+		}
+		if i+2 > len(src) {
+			return nil, errInvalid
+		}
+		o := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if o == 0 || o > len(dst) {
+			return nil, errInvalid
+		}
+		i, n, err = readLen(i, int(token&15))
+		if err != nil {
+			return nil, errInvalid
+		}
+		p := len(dst) - o
+		for k := 0; k < n+4; k++ {
+			dst = append(dst, dst[p+k])
+		}
+	}
+	return dst, nil
+}
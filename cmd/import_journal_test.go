@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalToLog(t *testing.T) {
+	fields := map[string]string{
+		"__REALTIME_TIMESTAMP": "1700000000123456",
+		"PRIORITY":             "6",
+		"SYSLOG_FACILITY":      "3",
+		"_HOSTNAME":            "host1",
+		"_SYSTEMD_UNIT":        "sshd.service",
+		"SYSLOG_IDENTIFIER":    "sshd",
+		"_PID":                 "123",
+		"MESSAGE":              "Accepted password for root\n",
+	}
+	ts, l, ok := journalToLog(fields)
+	if !ok {
+		t.Fatal("journalToLog failed")
+	}
+	if ts != 1700000000123456000 {
+		t.Errorf("time got %d", ts)
+	}
+	want := time.Unix(0, ts).Format(time.RFC3339Nano) + " host1 info:daemon sshd.service sshd[123] Accepted password for root"
+	if l != want {
+		t.Errorf("journalToLog\n got %q\nwant %q", l, want)
+	}
+	if _, _, ok := journalToLog(map[string]string{"MESSAGE": "no time"}); ok {
+		t.Error("journalToLog without timestamp must fail")
+	}
+}
+
+func TestGetJournalFormat(t *testing.T) {
+	tests := []struct {
+		head string
+		want string
+	}{
+		{"__CURSOR=s=abc\n__REALTIME_TIMESTAMP=1\n", "export"},
+		{"__REALTIME_TIMESTAMP=1\nMESSAGE=a\n", "export"},
+		{`{"__CURSOR":"s=abc","__REALTIME_TIMESTAMP":"1","MESSAGE":"a"}` + "\n", "json"},
+		{`{"time":"2024-01-01"}` + "\n", ""},
+		{"Jan  1 00:00:00 host test\n", ""},
+	}
+	for _, tt := range tests {
+		if got := getJournalFormat([]byte(tt.head)); got != tt.want {
+			t.Errorf("getJournalFormat(%q) got %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestReadJournalExport(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("__REALTIME_TIMESTAMP=1000\nMESSAGE=first\n\n")
+	b.WriteString("__REALTIME_TIMESTAMP=2000\nMESSAGE\n")
+	binary.Write(&b, binary.LittleEndian, uint64(8))
+	b.WriteString("line1\nl2\n")
+	b.WriteString("_HOSTNAME=h\n\n")
+	b.WriteString("__REALTIME_TIMESTAMP=3000\nMESSAGE=last")
+	got := []map[string]string{}
+	err := readJournalExport(bufio.NewReader(&b), func(m map[string]string) bool {
+		got = append(got, m)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("entries got %d, want 3", len(got))
+	}
+	if got[0]["MESSAGE"] != "first" || got[1]["MESSAGE"] != "line1\nl2" || got[1]["_HOSTNAME"] != "h" || got[2]["MESSAGE"] != "last" {
+		t.Errorf("entries got %v", got)
+	}
+}
+
+func TestReadJournalJSON(t *testing.T) {
+	s := `{"__REALTIME_TIMESTAMP":"1000","MESSAGE":"text","PRIORITY":"3"}
+{"__REALTIME_TIMESTAMP":"2000","MESSAGE":[104,105],"_PID":["1","2"]}
+`
+	got := []map[string]string{}
+	err := readJournalJSON(bufio.NewReader(strings.NewReader(s)), func(m map[string]string) bool {
+		got = append(got, m)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("entries got %d, want 2", len(got))
+	}
+	if got[0]["MESSAGE"] != "text" || got[1]["MESSAGE"] != "hi" || got[1]["_PID"] != "1" {
+		t.Errorf("entries got %v", got)
+	}
+}
+
+func TestReadJournalFile(t *testing.T) {
+	le := binary.LittleEndian
+	data := []string{"MESSAGE=hello journal", "_HOSTNAME=host1", "PRIORITY=4"}
+	f := make([]byte, 160)
+	copy(f, "LPKSHHRH")
+	le.PutUint64(f[88:], 160)
+	offs := []uint64{}
+	for _, d := range data {
+		o := make([]byte, 64+len(d))
+		o[0] = journalObjectData
+		le.PutUint64(o[8:], uint64(len(o)))
+		copy(o[64:], d)
+		offs = append(offs, uint64(len(f)))
+		f = append(f, o...)
+		for len(f)%8 != 0 {
+			f = append(f, 0)
+		}
+	}
+	e := make([]byte, 64+16*len(offs))
+	e[0] = journalObjectEntry
+	le.PutUint64(e[8:], uint64(len(e)))
+	le.PutUint64(e[24:], 1700000000000000)
+	for i, o := range offs {
+		le.PutUint64(e[64+i*16:], o)
+	}
+	le.PutUint64(f[136:], uint64(len(f)))
+	f = append(f, e...)
+	got := []map[string]string{}
+	err := readJournalFile(bytes.NewReader(f), func(m map[string]string) bool {
+		got = append(got, m)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("entries got %d, want 1", len(got))
+	}
+	if got[0]["MESSAGE"] != "hello journal" || got[0]["_HOSTNAME"] != "host1" || got[0]["__REALTIME_TIMESTAMP"] != "1700000000000000" {
+		t.Errorf("entry got %v", got[0])
+	}
+	if err := readJournalFile(bytes.NewReader(make([]byte, 200)), func(map[string]string) bool { return true }); err == nil {
+		t.Error("readJournalFile must fail for invalid file")
+	}
+}
+
+func TestDecodeLZ4Block(t *testing.T) {
+	// literals "abcd" then match offset 4 length 8
+	src := []byte{0x44, 'a', 'b', 'c', 'd', 4, 0, 0x10, 'x'}
+	got, err := decodeLZ4Block(src, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcdabcdabcdx" {
+		t.Errorf("decodeLZ4Block got %q", got)
+	}
+}
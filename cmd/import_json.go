@@ -0,0 +1,211 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// JSON import
+//
+// With --jsonRecords or --jsonTime, JSON array, NDJSON and concatenated JSON
+// are imported as one compact JSON line per record.
+// --jsonRecords is JSONPATH to the array of records like $.Records of CloudTrail.
+// --jsonTime is the field of timestamp in epoch (s/ms/us/ns) or string.
+
+var jsonRecords string
+var jsonTime string
+
+const utf8BOM = "\xef\xbb\xbf"
+
+// isJSONImport : check JSON import mode and head of JSON
+func isJSONImport(head []byte) bool {
+	if jsonRecords == "" && jsonTime == "" {
+		return false
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte(utf8BOM)), " \t\r\n")
+	return len(head) > 0 && (head[0] == '[' || head[0] == '{')
+}
+
+// getJSONPath : name like eventTime or a.b is $.eventTime or $.a.b
+func getJSONPath(s string) string {
+	if strings.HasPrefix(s, "$") {
+		return s
+	}
+	return "$." + s
+}
+
+func importJSON(path string, br *bufio.Reader) error {
+	e := newEntryImport(path)
+	te, err := newSourceTime(path, getSourceRefTime(path))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	err = readJSONRecords(br, func(rec any) bool {
+		j, err := json.Marshal(rec)
+		if err != nil {
+			return e.skip()
+		}
+		l := string(j)
+		t, ok := getJSONRecordTime(rec, l, te)
+		if !ok {
+			return e.skip()
+		}
+		return e.add(t.UnixNano(), l)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	e.done()
+	return nil
+}
+
+// readJSONRecords : read records of top level array or stream of JSON values.
+// The array is read by element, so large file is not loaded at once.
+func readJSONRecords(br *bufio.Reader, fn func(any) bool) error {
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	records := ""
+	if jsonRecords != "" {
+		records = getJSONPath(jsonRecords)
+	}
+	if records == "" {
+		if err := skipJSONSpace(br); err != nil {
+			return err
+		}
+		if c, err := br.Peek(1); err == nil && c[0] == '[' {
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+			for dec.More() {
+				var v any
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				if !fn(v) {
+					return nil
+				}
+			}
+			return nil
+		}
+	}
+	for {
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if records == "" {
+			if !fn(v) {
+				return nil
+			}
+			continue
+		}
+		r, err := jsonpath.Get(records, v)
+		if err != nil {
+			continue
+		}
+		a, ok := r.([]any)
+		if !ok {
+			a = []any{r}
+		}
+		for _, rec := range a {
+			if !fn(rec) {
+				return nil
+			}
+		}
+	}
+}
+
+func skipJSONSpace(br *bufio.Reader) error {
+	for {
+		c, err := br.Peek(3)
+		if string(c) == utf8BOM {
+			br.Discard(3)
+			continue
+		}
+		if len(c) > 0 && strings.IndexByte(" \t\r\n", c[0]) >= 0 {
+			br.Discard(1)
+			continue
+		}
+		if len(c) > 0 || err == io.EOF {
+			return nil
+		}
+		return err
+	}
+}
+
+// getJSONRecordTime : get time from --jsonTime field or line
+func getJSONRecordTime(rec any, l string, te *sourceTime) (time.Time, bool) {
+	if jsonTime == "" {
+		return te.extract([]byte(l))
+	}
+	v, err := jsonpath.Get(getJSONPath(jsonTime), rec)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch v := v.(type) {
+	case json.Number:
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return getEpochTime(string(v), f), true
+		}
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return getEpochTime(v, f), true
+		}
+		return te.extract([]byte(v))
+	}
+	return time.Time{}, false
+}
+
+// getEpochTime : epoch time in seconds, milliseconds, microseconds or nanoseconds
+// by the magnitude. Integer is parsed as is to keep precision of nanoseconds.
+func getEpochTime(s string, f float64) time.Time {
+	a := math.Abs(f)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case a < 1e11:
+			return time.Unix(i, 0)
+		case a < 1e14:
+			return time.UnixMilli(i)
+		case a < 1e17:
+			return time.UnixMicro(i)
+		}
+		return time.Unix(0, i)
+	}
+	switch {
+	case a < 1e11:
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1000)
+	case a < 1e14:
+		return time.UnixMicro(int64(math.Round(f * 1e3)))
+	case a < 1e17:
+		return time.Unix(0, int64(math.Round(f*1e3)))
+	}
+	return time.Unix(0, int64(f))
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetEpochTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"1714557600", time.Unix(1714557600, 0)},
+		{"1714557600.123456", time.Unix(1714557600, 123456000)},
+		{"1714557600123", time.Unix(1714557600, 123000000)},
+		{"1714557600123.5", time.Unix(1714557600, 123500000)},
+		{"1714557600123456", time.Unix(1714557600, 123456000)},
+		{"1714557600123456789", time.Unix(1714557600, 123456789)},
+	}
+	for _, tt := range tests {
+		f, _ := strconv.ParseFloat(tt.s, 64)
+		if got := getEpochTime(tt.s, f); !got.Equal(tt.want) {
+			t.Errorf("getEpochTime(%s) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	defer func() { jsonRecords, jsonTime = "", "" }()
+	tests := []struct {
+		records string
+		time    string
+		log     string
+		want    map[int64]string
+	}{
+		{"Records", "eventTime", `{"Records":[
+  {"eventTime":"2024-05-01T10:00:00Z","eventName":"ConsoleLogin"},
+  {"eventTime":"2024-05-01T10:00:01Z","eventName":"GetObject"}
+]}
+{"Records":[{"eventTime":"2024-05-01T10:00:02Z","eventName":"PutObject"}]}`,
+			map[int64]string{
+				time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).UnixNano(): `{"eventName":"ConsoleLogin","eventTime":"2024-05-01T10:00:00Z"}`,
+				time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC).UnixNano(): `{"eventName":"GetObject","eventTime":"2024-05-01T10:00:01Z"}`,
+				time.Date(2024, 5, 1, 10, 0, 2, 0, time.UTC).UnixNano(): `{"eventName":"PutObject","eventTime":"2024-05-01T10:00:02Z"}`,
+			}},
+		{"", "meta.ts", "\xef\xbb\xbf [\n {\"meta\":{\"ts\":1714557600123},\"msg\":\"a b\"},\n {\"meta\":{\"ts\":\"1714557601\"},\"msg\":\"c\"},\n {\"msg\":\"no time\"}\n]\n",
+			map[int64]string{
+				time.Unix(1714557600, 123000000).UnixNano(): `{"meta":{"ts":1714557600123},"msg":"a b"}`,
+				time.Unix(1714557601, 0).UnixNano():         `{"meta":{"ts":"1714557601"},"msg":"c"}`,
+			}},
+		{"", "ts", `{"ts":1714557600.5,"id":12345678901234567890}
+{"ts":"2024-05-01T10:00:01.250Z","id":2}
+`,
+			map[int64]string{
+				time.Unix(1714557600, 500000000).UnixNano():                     `{"id":12345678901234567890,"ts":1714557600.5}`,
+				time.Date(2024, 5, 1, 10, 0, 1, 250000000, time.UTC).UnixNano(): `{"id":2,"ts":"2024-05-01T10:00:01.250Z"}`,
+			}},
+	}
+	for i, tt := range tests {
+		setupImportTest(t)
+		jsonRecords, jsonTime = tt.records, tt.time
+		runImportTest(func() { doImport("test.json", strings.NewReader(tt.log)) })
+		got := map[int64]string{}
+		scanTestLogs(func(ti int64, k, v []byte) {
+			got[ti] = string(v)
+		})
+		if len(got) != len(tt.want) {
+			t.Errorf("#%d got %d logs %q, want %d", i, len(got), got, len(tt.want))
+		}
+		for ti, l := range tt.want {
+			if got[ti] != l {
+				t.Errorf("#%d log at %v = %q, want %q", i, time.Unix(0, ti), got[ti], l)
+			}
+		}
+	}
+}
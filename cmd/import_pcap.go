@@ -0,0 +1,740 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Packet capture
+//
+// DNS, HTTP and TLS client hello of pcap / pcapng files are converted to
+// one line per transaction. The time is the timestamp of the first packet.
+//  time dns src=IP sport=PORT dst=IP dport=53 id=ID query=NAME type=A rcode=NOERROR answer=A,B rtt=1ms
+//  time http src=IP sport=PORT dst=IP dport=80 host=HOST "GET http://HOST/path HTTP/1.1" status=200 ua="UA"
+//  time tls src=IP sport=PORT dst=IP dport=443 sni=NAME
+
+const (
+	pcapMagicUS    = 0xa1b2c3d4
+	pcapMagicNS    = 0xa1b23c4d
+	pcapngMagicSHB = 0x0a0d0d0a
+
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeSLL      = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// isPcap : check head of stream is pcap or pcapng
+func isPcap(head []byte) bool {
+	if len(head) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(head) {
+	case pcapMagicUS, pcapMagicNS, pcapngMagicSHB:
+		return true
+	}
+	switch binary.BigEndian.Uint32(head) {
+	case pcapMagicUS, pcapMagicNS:
+		return true
+	}
+	return false
+}
+
+func importPcap(path string, r *bufio.Reader) error {
+	e := newEntryImport(path)
+	p := newPcapDecoder(e.add)
+	if err := readPcap(r, p.packet); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	p.flush()
+	e.done()
+	return nil
+}
+
+// readPcap : read packets of pcap or pcapng. fn receives time, link type and data.
+func readPcap(r io.Reader, fn func(int64, int, []byte) bool) error {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngMagicSHB {
+		return readPcapng(r, magic, fn)
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	m := bo.Uint32(magic)
+	if m != pcapMagicUS && m != pcapMagicNS {
+		bo = binary.BigEndian
+		m = bo.Uint32(magic)
+	}
+	if m != pcapMagicUS && m != pcapMagicNS {
+		return errors.New("invalid pcap file")
+	}
+	unit := int64(1000)
+	if m == pcapMagicNS {
+		unit = 1
+	}
+	h := make([]byte, 20)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return err
+	}
+	linkType := int(bo.Uint32(h[16:]) & 0xffff)
+	rh := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, rh); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		n := bo.Uint32(rh[8:])
+		if n > 256*1024 {
+			return errors.New("invalid pcap packet length")
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil
+		}
+		t := int64(bo.Uint32(rh))*1000*1000*1000 + int64(bo.Uint32(rh[4:]))*unit
+		if !fn(t, linkType, data) {
+			return nil
+		}
+	}
+}
+
+type pcapngIface struct {
+	linkType int
+	// resolution of timestamp
+	tsPow10 bool
+	tsRes   int
+}
+
+// readPcapng : read packets of pcapng blocks.
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+func readPcapng(r io.Reader, first []byte, fn func(int64, int, []byte) bool) error {
+	var bo binary.ByteOrder = binary.LittleEndian
+	ifaces := []pcapngIface{}
+	bh := make([]byte, 8)
+	copy(bh, first)
+	if _, err := io.ReadFull(r, bh[4:]); err != nil {
+		return err
+	}
+	for {
+		blockType := binary.LittleEndian.Uint32(bh)
+		if blockType == pcapngMagicSHB {
+			// Section header block decides byte order
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(r, bom); err != nil {
+				return err
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom) == 0x1a2b3c4d:
+				bo = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom) == 0x1a2b3c4d:
+				bo = binary.BigEndian
+			default:
+				return errors.New("invalid pcapng section header")
+			}
+			ifaces = ifaces[:0]
+			n := bo.Uint32(bh[4:])
+			if n < 16 || n > 16*1024*1024 {
+				return errors.New("invalid pcapng block length")
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(n-12)); err != nil {
+				return err
+			}
+		} else {
+			n := bo.Uint32(bh[4:])
+			if n < 12 || n > 16*1024*1024 {
+				return errors.New("invalid pcapng block length")
+			}
+			b := make([]byte, n-8)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil
+			}
+			body := b[:len(b)-4]
+			switch bo.Uint32(bh) {
+			case 1:
+				// Interface description block
+				if len(body) < 8 {
+					return errors.New("invalid pcapng interface block")
+				}
+				ifc := pcapngIface{linkType: int(bo.Uint16(body)), tsPow10: true, tsRes: 6}
+				for o := body[8:]; len(o) >= 4; {
+					code := bo.Uint16(o)
+					l := int(bo.Uint16(o[2:]))
+					if code == 0 || 4+l > len(o) {
+						break
+					}
+					if code == 9 && l >= 1 {
+						ifc.tsPow10 = o[4]&0x80 == 0
+						ifc.tsRes = int(o[4] & 0x7f)
+					}
+					o = o[4+((l+3)&^3):]
+				}
+				ifaces = append(ifaces, ifc)
+			case 6:
+				// Enhanced packet block
+				if len(body) < 20 {
+					return errors.New("invalid pcapng packet block")
+				}
+				id := int(bo.Uint32(body))
+				if id >= len(ifaces) {
+					break
+				}
+				ts := uint64(bo.Uint32(body[4:]))<<32 | uint64(bo.Uint32(body[8:]))
+				cl := int(bo.Uint32(body[12:]))
+				if 20+cl > len(body) {
+					return errors.New("invalid pcapng packet length")
+				}
+				if !fn(ifaces[id].nanoTime(ts), ifaces[id].linkType, body[20:20+cl]) {
+					return nil
+				}
+			}
+		}
+		if _, err := io.ReadFull(r, bh); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (ifc *pcapngIface) nanoTime(ts uint64) int64 {
+	if ifc.tsPow10 {
+		if ifc.tsRes <= 9 {
+			m := uint64(1)
+			for i := ifc.tsRes; i < 9; i++ {
+				m *= 10
+			}
+			return int64(ts * m)
+		}
+		d := uint64(1)
+		for i := 9; i < ifc.tsRes; i++ {
+			d *= 10
+		}
+		return int64(ts / d)
+	}
+	if ifc.tsRes > 63 {
+		return 0
+	}
+	sec := ts >> ifc.tsRes
+	frac := ts & (1<<ifc.tsRes - 1)
+	return int64(sec)*1000*1000*1000 + int64(float64(frac)/float64(uint64(1)<<ifc.tsRes)*1e9)
+}
+
+// pcapFlow : address and port of packet
+type pcapFlow struct {
+	src   string
+	sport int
+	dst   string
+	dport int
+}
+
+func (f pcapFlow) reverse() pcapFlow {
+	return pcapFlow{src: f.dst, sport: f.dport, dst: f.src, dport: f.sport}
+}
+
+func (f pcapFlow) String() string {
+	return fmt.Sprintf("src=%s sport=%d dst=%s dport=%d", f.src, f.sport, f.dst, f.dport)
+}
+
+type pcapDNSKey struct {
+	flow pcapFlow
+	id   uint16
+}
+
+type pcapPending struct {
+	time int64
+	log  string
+}
+
+type pcapDecoder struct {
+	add  func(int64, string) bool
+	dns  map[pcapDNSKey]*pcapPending
+	http map[pcapFlow][]*pcapPending
+}
+
+func newPcapDecoder(add func(int64, string) bool) *pcapDecoder {
+	return &pcapDecoder{
+		add:  add,
+		dns:  make(map[pcapDNSKey]*pcapPending),
+		http: make(map[pcapFlow][]*pcapPending),
+	}
+}
+
+// packet : decode link layer to transport payload
+func (p *pcapDecoder) packet(t int64, linkType int, data []byte) bool {
+	var ip []byte
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return true
+		}
+		et := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		for (et == 0x8100 || et == 0x88a8) && len(data) >= 4 {
+			et = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		if et != 0x0800 && et != 0x86dd {
+			return true
+		}
+		ip = data
+	case linkTypeSLL:
+		if len(data) < 16 {
+			return true
+		}
+		ip = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return true
+		}
+		ip = data[20:]
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return true
+		}
+		ip = data[4:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		ip = data
+	default:
+		return true
+	}
+	flow, proto, payload, ok := decodeIP(ip)
+	if !ok {
+		return true
+	}
+	return p.transport(t, flow, proto, payload)
+}
+
+// decodeIP : get flow, protocol and payload of IPv4 or IPv6 packet
+func decodeIP(b []byte) (pcapFlow, int, []byte, bool) {
+	var f pcapFlow
+	if len(b) < 1 {
+		return f, 0, nil, false
+	}
+	var proto int
+	switch b[0] >> 4 {
+	case 4:
+		hl := int(b[0]&0x0f) * 4
+		if len(b) < 20 || hl < 20 || len(b) < hl {
+			return f, 0, nil, false
+		}
+		if binary.BigEndian.Uint16(b[6:])&0x1fff != 0 {
+			// Not first fragment
+			return f, 0, nil, false
+		}
+		if tl := int(binary.BigEndian.Uint16(b[2:])); tl >= hl && tl < len(b) {
+			b = b[:tl]
+		}
+		proto = int(b[9])
+		f.src = net.IP(b[12:16]).String()
+		f.dst = net.IP(b[16:20]).String()
+		b = b[hl:]
+	case 6:
+		if len(b) < 40 {
+			return f, 0, nil, false
+		}
+		if pl := int(binary.BigEndian.Uint16(b[4:])); 40+pl < len(b) {
+			b = b[:40+pl]
+		}
+		proto = int(b[6])
+		f.src = net.IP(b[8:24]).String()
+		f.dst = net.IP(b[24:40]).String()
+		b = b[40:]
+		// Skip extension headers
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(b) < 8 {
+				return f, 0, nil, false
+			}
+			proto = int(b[0])
+			l := (int(b[1]) + 1) * 8
+			if len(b) < l {
+				return f, 0, nil, false
+			}
+			b = b[l:]
+		}
+	default:
+		return f, 0, nil, false
+	}
+	switch proto {
+	case 6:
+		if len(b) < 20 {
+			return f, 0, nil, false
+		}
+		hl := int(b[12]>>4) * 4
+		if hl < 20 || len(b) < hl {
+			return f, 0, nil, false
+		}
+		f.sport = int(binary.BigEndian.Uint16(b))
+		f.dport = int(binary.BigEndian.Uint16(b[2:]))
+		return f, proto, b[hl:], true
+	case 17:
+		if len(b) < 8 {
+			return f, 0, nil, false
+		}
+		f.sport = int(binary.BigEndian.Uint16(b))
+		f.dport = int(binary.BigEndian.Uint16(b[2:]))
+		return f, proto, b[8:], true
+	}
+	return f, 0, nil, false
+}
+
+func (p *pcapDecoder) transport(t int64, f pcapFlow, proto int, b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+	if f.sport == 53 || f.dport == 53 {
+		if proto == 6 {
+			// DNS over TCP has length prefix
+			if len(b) < 2 {
+				return true
+			}
+			b = b[2:]
+		}
+		return p.dnsMessage(t, f, b)
+	}
+	if proto != 6 {
+		return true
+	}
+	if b[0] == 0x16 {
+		if sni, ok := getTLSSNI(b); ok {
+			return p.add(t, fmt.Sprintf("%s tls %s sni=%s", formatPcapTime(t), f, sni))
+		}
+		return true
+	}
+	return p.httpMessage(t, f, b)
+}
+
+func (p *pcapDecoder) dnsMessage(t int64, f pcapFlow, b []byte) bool {
+	m, ok := parseDNS(b)
+	if !ok {
+		return true
+	}
+	if !m.response {
+		p.dns[pcapDNSKey{flow: f, id: m.id}] = &pcapPending{
+			time: t,
+			log:  fmt.Sprintf("%s dns %s id=%d query=%s type=%s", formatPcapTime(t), f, m.id, m.name, m.qtype),
+		}
+		return true
+	}
+	key := pcapDNSKey{flow: f.reverse(), id: m.id}
+	res := fmt.Sprintf("rcode=%s answer=%s", m.rcode, strings.Join(m.answers, ","))
+	if q, ok := p.dns[key]; ok {
+		delete(p.dns, key)
+		return p.add(q.time, fmt.Sprintf("%s %s rtt=%v", q.log, res, time.Duration(t-q.time)))
+	}
+	return p.add(t, fmt.Sprintf("%s dns %s id=%d query=%s type=%s %s rtt=-", formatPcapTime(t), f.reverse(), m.id, m.name, m.qtype, res))
+}
+
+var httpMethods = []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+func (p *pcapDecoder) httpMessage(t int64, f pcapFlow, b []byte) bool {
+	if bytes.HasPrefix(b, []byte("HTTP/1.")) {
+		rf := f.reverse()
+		q := p.http[rf]
+		if len(q) < 1 {
+			return true
+		}
+		status := "-"
+		if a := strings.Fields(firstLine(b)); len(a) > 1 {
+			status = a[1]
+		}
+		if len(q) == 1 {
+			delete(p.http, rf)
+		} else {
+			p.http[rf] = q[1:]
+		}
+		return p.add(q[0].time, strings.Replace(q[0].log, " status=- ", " status="+status+" ", 1))
+	}
+	isReq := false
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, []byte(m)) {
+			isReq = true
+			break
+		}
+	}
+	if !isReq {
+		return true
+	}
+	a := strings.Fields(firstLine(b))
+	if len(a) != 3 || !strings.HasPrefix(a[2], "HTTP/") {
+		return true
+	}
+	host, ua := "", ""
+	for _, h := range strings.Split(string(b), "\r\n")[1:] {
+		if h == "" {
+			break
+		}
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case "host":
+			host = strings.TrimSpace(v)
+		case "user-agent":
+			ua = strings.TrimSpace(v)
+		}
+	}
+	if host == "" {
+		host = f.dst
+		if f.dport != 80 {
+			host = net.JoinHostPort(f.dst, strconv.Itoa(f.dport))
+		}
+	}
+	url := a[1]
+	if a[0] != "CONNECT" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + host + url
+	}
+	p.http[f] = append(p.http[f], &pcapPending{
+		time: t,
+		log:  fmt.Sprintf("%s http %s host=%s \"%s %s %s\" status=- ua=%q", formatPcapTime(t), f, host, a[0], url, a[2], ua),
+	})
+	return true
+}
+
+// flush : import transactions without response
+func (p *pcapDecoder) flush() {
+	list := []*pcapPending{}
+	for _, q := range p.dns {
+		list = append(list, &pcapPending{time: q.time, log: q.log + " rcode=- answer= rtt=-"})
+	}
+	for _, q := range p.http {
+		list = append(list, q...)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].time == list[j].time {
+			return list[i].log < list[j].log
+		}
+		return list[i].time < list[j].time
+	})
+	for _, q := range list {
+		if !p.add(q.time, q.log) {
+			return
+		}
+	}
+	p.dns = make(map[pcapDNSKey]*pcapPending)
+	p.http = make(map[pcapFlow][]*pcapPending)
+}
+
+func formatPcapTime(t int64) string {
+	return time.Unix(0, t).Format(time.RFC3339Nano)
+}
+
+func firstLine(b []byte) string {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), "\r")
+}
+
+type dnsMsg struct {
+	id       uint16
+	response bool
+	rcode    string
+	name     string
+	qtype    string
+	answers  []string
+}
+
+var dnsTypeNames = map[uint16]string{
+	1: "A", 2: "NS", 5: "CNAME", 6: "SOA", 12: "PTR", 15: "MX", 16: "TXT",
+	28: "AAAA", 33: "SRV", 64: "SVCB", 65: "HTTPS", 255: "ANY",
+}
+
+var dnsRcodeNames = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+
+func getDNSTypeName(t uint16) string {
+	if s, ok := dnsTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// parseDNS : parse question and answers of DNS message
+func parseDNS(b []byte) (*dnsMsg, bool) {
+	if len(b) < 12 {
+		return nil, false
+	}
+	be := binary.BigEndian
+	m := &dnsMsg{
+		id:       be.Uint16(b),
+		response: b[2]&0x80 != 0,
+	}
+	if rc := int(b[3] & 0x0f); rc < len(dnsRcodeNames) {
+		m.rcode = dnsRcodeNames[rc]
+	} else {
+		m.rcode = fmt.Sprintf("RCODE%d", rc)
+	}
+	qd := int(be.Uint16(b[4:]))
+	an := int(be.Uint16(b[6:]))
+	if qd < 1 {
+		return nil, false
+	}
+	name, o, ok := readDNSName(b, 12)
+	if !ok || o+4 > len(b) {
+		return nil, false
+	}
+	m.name = name
+	m.qtype = getDNSTypeName(be.Uint16(b[o:]))
+	o += 4
+	for i := 1; i < qd; i++ {
+		if _, o, ok = readDNSName(b, o); !ok || o+4 > len(b) {
+			return m, true
+		}
+		o += 4
+	}
+	for i := 0; i < an; i++ {
+		if _, o, ok = readDNSName(b, o); !ok || o+10 > len(b) {
+			break
+		}
+		t := be.Uint16(b[o:])
+		l := int(be.Uint16(b[o+8:]))
+		o += 10
+		if o+l > len(b) {
+			break
+		}
+		rd := b[o : o+l]
+		switch t {
+		case 1, 28:
+			if l == 4 || l == 16 {
+				m.answers = append(m.answers, net.IP(rd).String())
+			}
+		case 2, 5, 12:
+			if n, _, ok := readDNSName(b, o); ok {
+				m.answers = append(m.answers, n)
+			}
+		case 15:
+			if n, _, ok := readDNSName(b, o+2); ok && l > 2 {
+				m.answers = append(m.answers, n)
+			}
+		case 16:
+			for j := 0; j < len(rd); {
+				sl := int(rd[j])
+				if j+1+sl > len(rd) {
+					break
+				}
+				m.answers = append(m.answers, strings.ReplaceAll(string(rd[j+1:j+1+sl]), " ", "_"))
+				j += 1 + sl
+			}
+		}
+		o += l
+	}
+	return m, true
+}
+
+// readDNSName : read domain name at offset with compression pointer
+func readDNSName(b []byte, o int) (string, int, bool) {
+	labels := []string{}
+	next := -1
+	for jumps := 0; ; {
+		if o >= len(b) {
+			return "", 0, false
+		}
+		l := int(b[o])
+		switch {
+		case l == 0:
+			o++
+			if next < 0 {
+				next = o
+			}
+			if len(labels) == 0 {
+				return ".", next, true
+			}
+			return strings.Join(labels, "."), next, true
+		case l&0xc0 == 0xc0:
+			if o+1 >= len(b) || jumps > 32 {
+				return "", 0, false
+			}
+			if next < 0 {
+				next = o + 2
+			}
+			o = int(binary.BigEndian.Uint16(b[o:]) & 0x3fff)
+			jumps++
+		default:
+			if o+1+l > len(b) {
+				return "", 0, false
+			}
+			labels = append(labels, string(b[o+1:o+1+l]))
+			o += 1 + l
+		}
+	}
+}
+
+// getTLSSNI : get server name of TLS client hello
+func getTLSSNI(b []byte) (string, bool) {
+	be := binary.BigEndian
+	// record header(5) + handshake header(4) + version(2) + random(32)
+	if len(b) < 44 || b[0] != 0x16 || b[1] != 3 || b[5] != 1 {
+		return "", false
+	}
+	o := 43
+	if o >= len(b) {
+		return "", false
+	}
+	o += 1 + int(b[o])
+	if o+2 > len(b) {
+		return "", false
+	}
+	o += 2 + int(be.Uint16(b[o:]))
+	if o >= len(b) {
+		return "", false
+	}
+	o += 1 + int(b[o])
+	if o+2 > len(b) {
+		return "", false
+	}
+	end := o + 2 + int(be.Uint16(b[o:]))
+	o += 2
+	if end > len(b) {
+		end = len(b)
+	}
+	for o+4 <= end {
+		et := be.Uint16(b[o:])
+		el := int(be.Uint16(b[o+2:]))
+		o += 4
+		if o+el > end {
+			return "", false
+		}
+		if et == 0 && el >= 5 {
+			// server name list(2) + name type(1) + name length(2)
+			nl := int(be.Uint16(b[o+3:]))
+			if b[o+2] == 0 && o+5+nl <= end {
+				return string(b[o+5 : o+5+nl]), true
+			}
+			return "", false
+		}
+		o += el
+	}
+	return "", false
+}
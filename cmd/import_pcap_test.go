@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPacket : make ethernet frame of IPv4 packet
+func testPacket(proto byte, src, dst [4]byte, sport, dport uint16, payload []byte) []byte {
+	be := binary.BigEndian
+	var l4 []byte
+	if proto == 17 {
+		l4 = make([]byte, 8)
+		be.PutUint16(l4[4:], uint16(8+len(payload)))
+	} else {
+		l4 = make([]byte, 20)
+		l4[12] = 5 << 4
+	}
+	be.PutUint16(l4, sport)
+	be.PutUint16(l4[2:], dport)
+	l4 = append(l4, payload...)
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	be.PutUint16(ip[2:], uint16(20+len(l4)))
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:], src[:])
+	copy(ip[16:], dst[:])
+	eth := make([]byte, 14)
+	be.PutUint16(eth[12:], 0x0800)
+	return append(append(eth, ip...), l4...)
+}
+
+func testDNSMessage(id uint16, response bool, answer []byte) []byte {
+	be := binary.BigEndian
+	b := make([]byte, 12)
+	be.PutUint16(b, id)
+	be.PutUint16(b[4:], 1)
+	if response {
+		b[2] = 0x81
+		b[3] = 0x80
+		be.PutUint16(b[6:], 1)
+	}
+	b = append(b, 3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1)
+	if response {
+		// pointer to question name, type A, class IN, ttl, rdlength
+		b = append(b, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		b = append(b, answer...)
+	}
+	return b
+}
+
+func testClientHello(sni string) []byte {
+	be := binary.BigEndian
+	ext := make([]byte, 9)
+	be.PutUint16(ext[2:], uint16(5+len(sni)))
+	be.PutUint16(ext[4:], uint16(3+len(sni)))
+	be.PutUint16(ext[7:], uint16(len(sni)))
+	ext = append(ext, sni...)
+	hello := []byte{3, 3}
+	hello = append(hello, make([]byte, 32)...)
+	hello = append(hello, 0, 0, 2, 0x13, 0x01, 1, 0)
+	hello = append(hello, byte(len(ext)>>8), byte(len(ext)))
+	hello = append(hello, ext...)
+	hs := []byte{1, 0, byte(len(hello) >> 8), byte(len(hello))}
+	hs = append(hs, hello...)
+	rec := []byte{0x16, 3, 1, byte(len(hs) >> 8), byte(len(hs))}
+	return append(rec, hs...)
+}
+
+type testPcapPacket struct {
+	t    time.Time
+	data []byte
+}
+
+func testPcapPackets() []testPcapPacket {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := [4]byte{192, 168, 1, 10}
+	dnsSrv := [4]byte{8, 8, 8, 8}
+	web := [4]byte{10, 0, 0, 1}
+	return []testPcapPacket{
+		{base, testPacket(17, client, dnsSrv, 40000, 53, testDNSMessage(0x1234, false, nil))},
+		{base.Add(20 * time.Millisecond), testPacket(17, dnsSrv, client, 53, 40000, testDNSMessage(0x1234, true, []byte{93, 184, 216, 34}))},
+		{base.Add(time.Second), testPacket(6, client, web, 50000, 80, []byte("GET /index.php?id=1%20or%201=1 HTTP/1.1\r\nHost: www.example.com\r\nUser-Agent: curl/8.0\r\n\r\n"))},
+		{base.Add(time.Second + time.Millisecond), testPacket(6, web, client, 80, 50000, []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))},
+		{base.Add(2 * time.Second), testPacket(6, client, web, 50001, 443, testClientHello("secure.example.com"))},
+		{base.Add(3 * time.Second), testPacket(17, client, dnsSrv, 40001, 53, testDNSMessage(0x5678, false, nil))},
+	}
+}
+
+func testPcapWant() []string {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []string{
+		formatPcapTime(base.UnixNano()) + " dns src=192.168.1.10 sport=40000 dst=8.8.8.8 dport=53 id=4660 query=www.example.com type=A rcode=NOERROR answer=93.184.216.34 rtt=20ms",
+		formatPcapTime(base.Add(time.Second).UnixNano()) + ` http src=192.168.1.10 sport=50000 dst=10.0.0.1 dport=80 host=www.example.com "GET http://www.example.com/index.php?id=1%20or%201=1 HTTP/1.1" status=200 ua="curl/8.0"`,
+		formatPcapTime(base.Add(2*time.Second).UnixNano()) + " tls src=192.168.1.10 sport=50001 dst=10.0.0.1 dport=443 sni=secure.example.com",
+		formatPcapTime(base.Add(3*time.Second).UnixNano()) + " dns src=192.168.1.10 sport=40001 dst=8.8.8.8 dport=53 id=22136 query=www.example.com type=A rcode=- answer= rtt=-",
+	}
+}
+
+func checkPcapLogs(t *testing.T, got []string) {
+	want := testPcapWant()
+	if len(got) != len(want) {
+		t.Fatalf("logs got %d, want %d\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("log %d\n got %q\nwant %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadPcap(t *testing.T) {
+	le := binary.LittleEndian
+	var b bytes.Buffer
+	h := make([]byte, 24)
+	le.PutUint32(h, pcapMagicUS)
+	le.PutUint16(h[4:], 2)
+	le.PutUint16(h[6:], 4)
+	le.PutUint32(h[16:], 65535)
+	le.PutUint32(h[20:], linkTypeEthernet)
+	b.Write(h)
+	for _, p := range testPcapPackets() {
+		rh := make([]byte, 16)
+		le.PutUint32(rh, uint32(p.t.Unix()))
+		le.PutUint32(rh[4:], uint32(p.t.Nanosecond()/1000))
+		le.PutUint32(rh[8:], uint32(len(p.data)))
+		le.PutUint32(rh[12:], uint32(len(p.data)))
+		b.Write(rh)
+		b.Write(p.data)
+	}
+	if !isPcap(b.Bytes()) {
+		t.Fatal("isPcap failed")
+	}
+	got := []string{}
+	d := newPcapDecoder(func(_ int64, l string) bool {
+		got = append(got, l)
+		return true
+	})
+	if err := readPcap(&b, d.packet); err != nil {
+		t.Fatal(err)
+	}
+	d.flush()
+	checkPcapLogs(t, got)
+}
+
+func TestReadPcapng(t *testing.T) {
+	le := binary.LittleEndian
+	var b bytes.Buffer
+	block := func(bt uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		h := make([]byte, 8)
+		le.PutUint32(h, bt)
+		le.PutUint32(h[4:], uint32(12+len(body)))
+		b.Write(h)
+		b.Write(body)
+		b.Write(h[4:])
+	}
+	shb := make([]byte, 16)
+	le.PutUint32(shb, 0x1a2b3c4d)
+	le.PutUint16(shb[4:], 1)
+	le.PutUint64(shb[8:], ^uint64(0))
+	block(pcapngMagicSHB, shb)
+	// nanosecond resolution
+	idb := make([]byte, 8)
+	le.PutUint16(idb, linkTypeEthernet)
+	idb = append(idb, 9, 0, 1, 0, 9, 0, 0, 0, 0, 0, 0, 0)
+	block(1, idb)
+	for _, p := range testPcapPackets() {
+		epb := make([]byte, 20)
+		ts := uint64(p.t.UnixNano())
+		le.PutUint32(epb[4:], uint32(ts>>32))
+		le.PutUint32(epb[8:], uint32(ts))
+		le.PutUint32(epb[12:], uint32(len(p.data)))
+		le.PutUint32(epb[16:], uint32(len(p.data)))
+		block(6, append(epb, p.data...))
+	}
+	if !isPcap(b.Bytes()) {
+		t.Fatal("isPcap failed")
+	}
+	got := []string{}
+	d := newPcapDecoder(func(_ int64, l string) bool {
+		got = append(got, l)
+		return true
+	})
+	if err := readPcap(&b, d.packet); err != nil {
+		t.Fatal(err)
+	}
+	d.flush()
+	checkPcapLogs(t, got)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// Import profiles
+//
+// Profile sets timestamp format, multiline settings, line filter and fields
+// of common log formats. The profile is recorded in meta "profile" of datastore
+// with the fields, so that analysis commands can use the fields by name.
+
+var importProfile string
+
+type logProfile struct {
+	Name        string
+	Descr       string
+	TimeFormat  string
+	TZ          string
+	MLStart     string
+	Filter      string
+	Fields      string
+	GrokPat     string
+	JSONRecords string
+	JSONTime    string
+}
+
+var logProfiles = []logProfile{
+	{
+		Name:       "nginx",
+		Descr:      "nginx access log (combined)",
+		TimeFormat: "02/Jan/2006:15:04:05 -0700",
+		Fields:     "grok",
+		GrokPat:    `%{IPORHOST:client} %{NOTSPACE:ident} %{NOTSPACE:user} \[%{HTTPDATE:time}\] "(?:%{WORD:method} %{NOTSPACE:path}(?: HTTP/%{NUMBER:version})?|%{DATA:request})" %{INT:status} (?:%{INT:bytes}|-) "%{DATA:referrer}" "%{DATA:agent}"`,
+	},
+	{
+		Name:       "apache",
+		Descr:      "Apache access log (combined)",
+		TimeFormat: "02/Jan/2006:15:04:05 -0700",
+		Fields:     "grok",
+		GrokPat:    `%{IPORHOST:client} %{NOTSPACE:ident} %{NOTSPACE:user} \[%{HTTPDATE:time}\] "(?:%{WORD:method} %{NOTSPACE:path}(?: HTTP/%{NUMBER:version})?|%{DATA:request})" %{INT:status} (?:%{INT:bytes}|-)(?: "%{DATA:referrer}" "%{DATA:agent}")?`,
+	},
+	{
+		Name:    "elb",
+		Descr:   "AWS Classic Load Balancer access log",
+		Fields:  "grok",
+		GrokPat: `^%{TIMESTAMP_ISO8601:time} %{NOTSPACE:elb} %{IP:client}:%{INT:client_port} (?:%{IP:backend}:%{INT:backend_port}|-) %{NUMBER:request_time} %{NUMBER:backend_time} %{NUMBER:response_time} (?:%{INT:status}|-) (?:%{INT:backend_status}|-) %{INT:received_bytes} %{INT:sent_bytes} "(?:%{WORD:method} %{NOTSPACE:url} %{NOTSPACE:protocol}|%{DATA:request})"`,
+	},
+	{
+		Name:    "alb",
+		Descr:   "AWS Application Load Balancer access log",
+		Fields:  "grok",
+		GrokPat: `^%{NOTSPACE:type} %{TIMESTAMP_ISO8601:time} %{NOTSPACE:elb} %{IP:client}:%{INT:client_port} (?:%{IP:target}:%{INT:target_port}|-) %{NUMBER:request_time} %{NUMBER:target_time} %{NUMBER:response_time} (?:%{INT:status}|-) (?:%{INT:target_status}|-) %{INT:received_bytes} %{INT:sent_bytes} "(?:%{WORD:method} %{NOTSPACE:url} %{NOTSPACE:protocol}|%{DATA:request})" "%{DATA:agent}" %{NOTSPACE:ssl_cipher} %{NOTSPACE:ssl_protocol}`,
+	},
+	{
+		Name:        "cloudtrail",
+		Descr:       "AWS CloudTrail log (Records JSON)",
+		Fields:      "json",
+		JSONRecords: "$.Records",
+		JSONTime:    "eventTime",
+	},
+	{
+		Name:    "zeek",
+		Descr:   "Zeek (Bro) TSV log",
+		Filter:  `^[^#]`,
+		Fields:  "grok",
+		GrokPat: `^%{NUMBER:ts}\t%{NOTSPACE:uid}\t%{IP:orig_h}\t%{INT:orig_p}\t%{IP:resp_h}\t%{INT:resp_p}\t%{GREEDYDATA:rest}`,
+	},
+	{
+		Name:       "iis",
+		Descr:      "Microsoft IIS W3C log (default fields)",
+		TimeFormat: "2006-01-02 15:04:05",
+		TZ:         "UTC",
+		Filter:     `^[^#]`,
+		Fields:     "grok",
+		GrokPat:    `^%{TIMESTAMP_ISO8601:time} %{IPORHOST:server} %{WORD:method} %{NOTSPACE:path} %{NOTSPACE:query} %{INT:port} %{NOTSPACE:user} %{IPORHOST:client} %{NOTSPACE:agent} (?:%{NOTSPACE:referrer} )?%{INT:status} %{INT:substatus} %{INT:win32_status} %{INT:time_taken}`,
+	},
+	{
+		Name:       "dhcp",
+		Descr:      "Windows DHCP server audit log",
+		TimeFormat: "01/02/06,15:04:05",
+		Filter:     `^\d+,`,
+		Fields:     "grok",
+		GrokPat:    `^%{INT:id},%{DATA:date},%{DATA:time},%{DATA:description},%{DATA:ip},%{DATA:host},%{DATA:mac},`,
+	},
+	{
+		Name:    "asa",
+		Descr:   "Cisco ASA syslog",
+		Fields:  "grok",
+		GrokPat: `%%{WORD:facility}-%{INT:severity}-%{INT:message_id}: %{GREEDYDATA:message}`,
+	},
+	{
+		Name:       "java",
+		Descr:      "Java application log with stack trace",
+		TimeFormat: "2006-01-02 15:04:05,000",
+		MLStart:    `^\d{4}-\d\d-\d\d[ T]\d\d:\d\d:\d\d`,
+		Fields:     "grok",
+		GrokPat:    `^%{TIMESTAMP_ISO8601:time}\s+(?:\[%{DATA:thread}\]\s+)?%{LOGLEVEL:level}\s+%{GREEDYDATA:message}`,
+	},
+}
+
+// getLogProfile : get profile by name
+func getLogProfile(name string) *logProfile {
+	for i := range logProfiles {
+		if logProfiles[i].Name == name {
+			return &logProfiles[i]
+		}
+	}
+	return nil
+}
+
+// getLogProfileNames : get sorted names of profiles
+func getLogProfileNames() []string {
+	r := []string{}
+	for _, p := range logProfiles {
+		r = append(r, p.Name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// setupProfile : apply import profile. The profile of datastore is used
+// when --profile is not specified. Command line settings have priority.
+func setupProfile() error {
+	var stored string
+	db.View(func(tx *bbolt.Tx) error {
+		stored = getMeta(tx, "profile")
+		return nil
+	})
+	if importProfile == "" {
+		importProfile = stored
+	}
+	if importProfile == "" {
+		return nil
+	}
+	if stored != "" && stored != importProfile {
+		return fmt.Errorf("datastore has %s profile", stored)
+	}
+	p := getLogProfile(importProfile)
+	if p == nil {
+		return fmt.Errorf("invalid profile %s (%s)", importProfile, strings.Join(getLogProfileNames(), "|"))
+	}
+	applyLogProfile(p)
+	if stored != "" {
+		return nil
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return setMeta(tx, "profile", p.Name)
+	})
+}
+
+// applyLogProfile : set import settings of profile
+func applyLogProfile(p *logProfile) {
+	if timeFormat == "" && timeRegex == "" {
+		timeFormat = p.TimeFormat
+	}
+	if timeZone == "" {
+		timeZone = p.TZ
+	}
+	if mlStart == "" && mlSep == "" && mlLines == 0 {
+		mlStart = p.MLStart
+	}
+	if importFilter == nil && p.Filter != "" {
+		importFilter = regexp.MustCompile(p.Filter)
+	}
+	if fieldsMode == "" {
+		fieldsMode = p.Fields
+		grokPat = p.GrokPat
+		grokDef = ""
+	}
+	if jsonRecords == "" && jsonTime == "" {
+		jsonRecords = p.JSONRecords
+		jsonTime = p.JSONTime
+	}
+}
+
+// setStoredGrok : use grok pattern of fields in datastore when -x is not specified
+func setStoredGrok() {
+	if grokPat != "" || db == nil {
+		return
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		if getMeta(tx, "fields") == "grok" {
+			grokPat = getMeta(tx, "fieldsGrokPat")
+			grokDef = getMeta(tx, "fieldsGrokDef")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func resetProfile() {
+	importProfile, timeFormat, timeRegex, timeZone = "", "", "", ""
+	mlStart, mlSep, mlLines = "", "", 0
+	importFilter = nil
+	fieldsMode, grokPat, grokDef = "", "", ""
+	jsonRecords, jsonTime = "", ""
+	gr = nil
+}
+
+func TestLogProfiles(t *testing.T) {
+	defer resetProfile()
+	tests := []struct {
+		profile string
+		log     string
+		skip    string
+		field   string
+		value   string
+		time    time.Time
+	}{
+		{"nginx", `192.168.1.5 - - [10/Oct/2024:13:55:36 +0900] "GET /index.html HTTP/1.1" 404 153 "-" "curl/8.0"`, "",
+			"status", "404", time.Date(2024, 10, 10, 4, 55, 36, 0, time.UTC)},
+		{"apache", `192.168.1.5 - frank [10/Oct/2024:13:55:36 -0700] "POST /login HTTP/1.0" 200 2326`, "",
+			"user", "frank", time.Date(2024, 10, 10, 20, 55, 36, 0, time.UTC)},
+		{"elb", `2024-10-10T12:00:00.123456Z my-elb 192.0.2.10:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1"`, "",
+			"backend", "10.0.0.1", time.Date(2024, 10, 10, 12, 0, 0, 123456000, time.UTC)},
+		{"alb", `https 2024-10-10T12:00:00.000000Z app/my-lb/50dc6c495c0c9188 192.0.2.10:46532 10.0.0.66:9000 0.000 0.001 0.000 502 - 34 366 "GET https://www.example.com:443/ HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing`, "",
+			"status", "502", time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC)},
+		{"zeek", "1728561600.123456\tCHhAvVGS1DHFjwGM9\t192.168.1.10\t50000\t8.8.8.8\t53\tudp\tdns", "#fields\tts\tuid",
+			"resp_p", "53", time.Unix(1728561600, 123456000)},
+		{"iis", `2024-10-10 12:00:00 10.0.0.1 GET /default.htm - 80 - 192.168.1.5 Mozilla/5.0 - 200 0 0 15`, "#Fields: date time s-ip",
+			"client", "192.168.1.5", time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC)},
+		{"dhcp", `10,10/10/24,12:00:00,Assign,192.168.1.20,host1.example.com,AABBCCDDEEFF,,123,0,,,`, "ID,Date,Time,Description",
+			"mac", "AABBCCDDEEFF", time.Date(2024, 10, 10, 12, 0, 0, 0, time.Local)},
+		{"asa", `Oct 10 2024 12:00:00 fw1 : %ASA-6-302013: Built outbound TCP connection 1 for outside:8.8.8.8/443`, "",
+			"message_id", "302013", time.Date(2024, 10, 10, 12, 0, 0, 0, time.Local)},
+		{"java", `2024-10-10 12:00:00,123 [main] ERROR c.e.App - failed`, "\tat com.example.App.main(App.java:10)",
+			"level", "ERROR", time.Date(2024, 10, 10, 12, 0, 0, 123000000, time.Local)},
+	}
+	if err := setupTimeGrinder(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		resetProfile()
+		p := getLogProfile(tt.profile)
+		if p == nil {
+			t.Fatalf("no profile %s", tt.profile)
+		}
+		applyLogProfile(p)
+		setGrok()
+		f := getFields(fieldsMode, tt.log)
+		if f[tt.field] != tt.value {
+			t.Errorf("%s: field %s = %q, want %q", tt.profile, tt.field, f[tt.field], tt.value)
+		}
+		te, err := newSourceTime("test.log", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts, ok := te.extract([]byte(tt.log)); !ok || !ts.Truncate(time.Microsecond).Equal(tt.time) {
+			t.Errorf("%s: time = %v %v, want %v", tt.profile, ts, ok, tt.time)
+		}
+		// skip is header line to filter out or continuation line of multiline log
+		if tt.skip != "" {
+			filtered := importFilter != nil && !importFilter.MatchString(tt.skip)
+			continued := mlStart != "" && !regexp.MustCompile(mlStart).MatchString(tt.skip)
+			if !filtered && !continued {
+				t.Errorf("%s: %q is not skipped", tt.profile, tt.skip)
+			}
+		}
+	}
+}
+
+func TestCloudTrailProfile(t *testing.T) {
+	defer resetProfile()
+	resetProfile()
+	applyLogProfile(getLogProfile("cloudtrail"))
+	setupImportTest(t)
+	log := `{"Records":[
+{"eventVersion":"1.08","eventTime":"2024-10-10T12:00:00Z","eventName":"ConsoleLogin"},
+{"eventVersion":"1.08","eventTime":"2024-10-10T12:00:05Z","eventName":"GetObject"}
+]}`
+	runImportTest(func() { doImport("123456789012_CloudTrail_ap-northeast-1_20241010T1200Z.json", strings.NewReader(log)) })
+	want := map[int64]string{
+		time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC).UnixNano(): "ConsoleLogin",
+		time.Date(2024, 10, 10, 12, 0, 5, 0, time.UTC).UnixNano(): "GetObject",
+	}
+	n := 0
+	scanTestLogs(func(ti int64, k, v []byte) {
+		n++
+		if f := getFields(fieldsMode, string(v)); f["eventName"] != want[ti] {
+			t.Errorf("cloudtrail: log at %v eventName = %q, want %q", time.Unix(0, ti), f["eventName"], want[ti])
+		}
+	})
+	if n != len(want) {
+		t.Errorf("cloudtrail: got %d logs, want %d", n, len(want))
+	}
+}
+
+func TestSetupProfile(t *testing.T) {
+	defer resetProfile()
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	resetProfile()
+	importProfile = "unknown"
+	if err := setupProfile(); err == nil {
+		t.Error("unknown profile is accepted")
+	}
+	resetProfile()
+	importProfile = "nginx"
+	if err := setupProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupFields(); err != nil {
+		t.Fatal(err)
+	}
+	// profile of datastore is used without --profile
+	resetProfile()
+	if err := setupProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if importProfile != "nginx" || fieldsMode != "grok" || timeFormat == "" {
+		t.Errorf("stored profile is not applied %q %q %q", importProfile, fieldsMode, timeFormat)
+	}
+	resetProfile()
+	importProfile = "iis"
+	if err := setupProfile(); err == nil {
+		t.Error("other profile is accepted")
+	}
+	// analysis commands use grok pattern of datastore
+	resetProfile()
+	setStoredGrok()
+	if grokPat != getLogProfile("nginx").GrokPat {
+		t.Errorf("stored grok pattern = %q", grokPat)
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		if getMeta(tx, "profile") != "nginx" {
+			t.Errorf("profile meta = %q", getMeta(tx, "profile"))
+		}
+		return nil
+	})
+}
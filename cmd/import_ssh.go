@@ -17,8 +17,8 @@ package cmd
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
+	"io"
 	"net"
 	"net/url"
 	"os"
@@ -31,27 +31,19 @@ import (
 )
 
 func importFromSCP() {
-	if sshKey == "" {
-		sshKey = filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
-	} else if strings.HasPrefix(sshKey, "~/") {
-		sshKey = strings.Replace(sshKey, "~/", os.Getenv("HOME"), 1)
-	}
 	u, err := url.Parse(source)
 	if err != nil {
 		teaProg.Send(err)
 		return
 	}
-	pass, ok := u.User.Password()
-	if !ok {
-		pass = ""
-	}
-	auth := scp.NewKeyAuth(sshKey, u.User.Username(), pass)
-	provider := scp.NewAuthProvider(auth, nil)
-	config, err := provider.ClientConfig()
+	config, closer, err := getSSHConfig(u)
 	if err != nil {
 		teaProg.Send(err)
 		return
 	}
+	if closer != nil {
+		defer closer.Close()
+	}
 	sv := u.Host
 	if !strings.Contains(sv, ":") {
 		sv += ":22"
@@ -78,15 +70,12 @@ func importFromSCP() {
 				teaProg.Send(err)
 				return
 			}
-			ext := strings.ToLower(filepath.Ext(u.Path))
-			if ext == ".gz" {
-				if gzr, err := gzip.NewReader(r); err == nil {
-					doImport(source+path, gzr)
-				}
-			} else {
-				doImport(source+path, r)
-			}
+			err = walkArchive(source+path, r, filter, importArchiveEnt)
 			r.Close()
+			if err != nil {
+				teaProg.Send(err)
+				return
+			}
 		}
 	} else {
 		r, err := service.Open(context.Background(), u.Path)
@@ -94,40 +83,28 @@ func importFromSCP() {
 			teaProg.Send(err)
 			return
 		}
-		ext := strings.ToLower(filepath.Ext(u.Path))
-		if ext == ".gz" {
-			if gzr, err := gzip.NewReader(r); err == nil {
-				doImport(source, gzr)
-			}
-		} else {
-			doImport(source, r)
-		}
+		err = walkArchive(source, r, nil, importArchiveEnt)
 		r.Close()
+		if err != nil {
+			teaProg.Send(err)
+		}
 	}
 }
 
 func importFromSSH() {
-	if sshKey == "" {
-		sshKey = filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
-	} else if strings.HasPrefix(sshKey, "~/") {
-		sshKey = strings.Replace(sshKey, "~/", os.Getenv("HOME"), 1)
-	}
 	u, err := url.Parse(source)
 	if err != nil {
 		teaProg.Send(err)
 		return
 	}
-	pass, ok := u.User.Password()
-	if !ok {
-		pass = ""
-	}
-	auth := scp.NewKeyAuth(sshKey, u.User.Username(), pass)
-	provider := scp.NewAuthProvider(auth, nil)
-	config, err := provider.ClientConfig()
+	config, closer, err := getSSHConfig(u)
 	if err != nil {
 		teaProg.Send(err)
 		return
 	}
+	if closer != nil {
+		defer closer.Close()
+	}
 	sv := u.Host
 	if !strings.Contains(sv, ":") {
 		sv += ":22"
@@ -162,3 +139,31 @@ func importFromSSH() {
 	r := bytes.NewReader(stdout)
 	doImport(sv+":"+command, r)
 }
+
+// getSSHConfig : config of ssh and scp source. Password of URL is for the key.
+// Key is not used with --sshAgent unless --key is specified.
+func getSSHConfig(u *url.URL) (*ssh.ClientConfig, io.Closer, error) {
+	var config *ssh.ClientConfig
+	if sshAgent && sshKey == "" {
+		config = &ssh.ClientConfig{
+			User:            u.User.Username(),
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}
+	} else {
+		key := sshKey
+		if key == "" {
+			key = filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
+		}
+		pass, _ := u.User.Password()
+		provider := scp.NewAuthProvider(scp.NewKeyAuth(expandHome(key), u.User.Username(), pass), nil)
+		var err error
+		if config, err = provider.ClientConfig(); err != nil {
+			return nil, nil, err
+		}
+	}
+	closer, err := setSSHOptions(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, closer, nil
+}
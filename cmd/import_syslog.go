@@ -0,0 +1,471 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+var syslogStopAfter string
+var syslogStopLines int
+var syslogTLSCert string
+var syslogTLSKey string
+
+// maxSyslogSize : max size of syslog message on TCP
+const maxSyslogSize = 64 * 1024
+
+// syslogReceiver : receive syslog messages and send them to logCh
+type syslogReceiver struct {
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	hash      string
+	path      string
+	lastTime  int64
+	readBytes int64
+	readLines int
+	skipLines int
+	conns     map[net.Conn]bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSyslogReceiver(path string) *syslogReceiver {
+	return &syslogReceiver{
+		hash:  getSHA1(fmt.Sprintf("%s %d", path, time.Now().UnixNano())),
+		path:  path,
+		conns: make(map[net.Conn]bool),
+		done:  make(chan struct{}),
+	}
+}
+
+// importFromSyslog : listen syslog://, syslog+tcp:// or syslog+tls:// until stopped
+func importFromSyslog() {
+	u, err := url.Parse(source)
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "514")
+	}
+	var stopAfter time.Duration
+	if syslogStopAfter != "" {
+		if stopAfter, err = str2duration.ParseDuration(syslogStopAfter); err != nil {
+			teaProg.Send(err)
+			return
+		}
+	}
+	r := newSyslogReceiver(source)
+	var l io.Closer
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			teaProg.Send(err)
+			return
+		}
+		l = pc
+		r.wg.Add(1)
+		go r.serveUDP(pc)
+	case "syslog+tcp", "syslog+tls":
+		var ln net.Listener
+		if u.Scheme == "syslog+tls" {
+			cfg, err := getSyslogTLSConfig()
+			if err != nil {
+				teaProg.Send(err)
+				return
+			}
+			ln, err = tls.Listen("tcp", addr, cfg)
+			if err != nil {
+				teaProg.Send(err)
+				return
+			}
+		} else {
+			if ln, err = net.Listen("tcp", addr); err != nil {
+				teaProg.Send(err)
+				return
+			}
+		}
+		l = ln
+		r.wg.Add(1)
+		go r.serveTCP(ln)
+	default:
+		teaProg.Send(fmt.Errorf("invalid syslog scheme %s", u.Scheme))
+		return
+	}
+	addImportTotal(1, 0, 0)
+	r.wait(stopAfter)
+	l.Close()
+	r.closeConns()
+	r.wg.Wait()
+	recordSource(r.path, r.hash, r.readBytes, r.readLines, r.skipLines)
+	r.sendProgress()
+}
+
+// wait : wait for stop by user, duration or lines
+func (r *syslogReceiver) wait(stopAfter time.Duration) {
+	timer := time.NewTicker(time.Second)
+	defer timer.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-timer.C:
+			if stopImport || (stopAfter > 0 && time.Since(start) >= stopAfter) {
+				r.stop()
+				return
+			}
+			r.sendProgress()
+		}
+	}
+}
+
+func (r *syslogReceiver) stop() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *syslogReceiver) stopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *syslogReceiver) sendProgress() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	teaProg.Send(ImportMsg{
+		Done:  false,
+		Path:  r.path,
+		Bytes: r.readBytes,
+		Lines: r.readLines,
+		Skip:  r.skipLines,
+	})
+}
+
+func (r *syslogReceiver) serveUDP(pc net.PacketConn) {
+	defer r.wg.Done()
+	buf := make([]byte, maxSyslogSize)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		r.add(string(buf[:n]), from)
+	}
+}
+
+func (r *syslogReceiver) serveTCP(ln net.Listener) {
+	defer r.wg.Done()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		if r.stopped() {
+			r.mu.Unlock()
+			c.Close()
+			return
+		}
+		r.conns[c] = true
+		r.wg.Add(1)
+		r.mu.Unlock()
+		go r.readStream(c)
+	}
+}
+
+func (r *syslogReceiver) closeConns() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.conns {
+		c.Close()
+	}
+}
+
+// readStream : read messages framed by octet counting or new line (RFC6587)
+func (r *syslogReceiver) readStream(c net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, c)
+		r.mu.Unlock()
+		c.Close()
+	}()
+	br := bufio.NewReaderSize(c, maxSyslogSize)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return
+		}
+		if b[0] >= '0' && b[0] <= '9' {
+			if n, l := getOctetCount(br); n > 0 {
+				br.Discard(l)
+				buf := make([]byte, n)
+				if _, err := io.ReadFull(br, buf); err != nil {
+					return
+				}
+				r.add(string(buf), c.RemoteAddr())
+				continue
+			}
+		}
+		l, err := br.ReadString('\n')
+		if l != "" {
+			r.add(l, c.RemoteAddr())
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// getOctetCount : get length of message and size of prefix like "123 " in octet counting frame.
+// Message after the prefix starts with "<" of PRI. Line starting with digits in new line framing returns 0.
+func getOctetCount(br *bufio.Reader) (int, int) {
+	for i := 1; i <= len(strconv.Itoa(maxSyslogSize))+1; i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return 0, 0
+		}
+		c := b[i-1]
+		if c == ' ' && i > 1 {
+			n, err := strconv.Atoi(string(b[:i-1]))
+			if err != nil || n > maxSyslogSize {
+				return 0, 0
+			}
+			if b, err := br.Peek(i + 1); err != nil || b[i] != '<' {
+				return 0, 0
+			}
+			return n, i
+		}
+		if c < '0' || c > '9' {
+			return 0, 0
+		}
+	}
+	return 0, 0
+}
+
+// add : parse syslog message and send it to logCh
+func (r *syslogReceiver) add(msg string, from net.Addr) {
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	if msg == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped() {
+		return
+	}
+	r.readBytes += int64(len(msg))
+	r.readLines++
+	addImportTotal(0, 1, int64(len(msg)))
+	if importFilter != nil && !importFilter.MatchString(msg) {
+		r.skipLines++
+		return
+	}
+	host := ""
+	if from != nil {
+		if h, _, err := net.SplitHostPort(from.String()); err == nil {
+			host = h
+		}
+	}
+	t, l := parseSyslog(msg, host, time.Now())
+	d := 0
+	if r.lastTime > 0 {
+		d = int(t - r.lastTime)
+	}
+	r.lastTime = t
+	logCh <- &LogEnt{
+		Time:  t,
+		Log:   l,
+		Delta: d,
+		Hash:  r.hash,
+		Line:  r.readLines,
+	}
+	if syslogStopLines > 0 && r.readLines-r.skipLines >= syslogStopLines {
+		r.stop()
+	}
+}
+
+// parseSyslog : parse RFC3164 or RFC5424 message to the same format as TWSNMP FC syslog
+func parseSyslog(msg, from string, now time.Time) (int64, string) {
+	sv, fac := -1, -1
+	if strings.HasPrefix(msg, "<") {
+		if e := strings.IndexByte(msg, '>'); e > 1 && e < 5 {
+			if pri, err := strconv.Atoi(msg[1:e]); err == nil && pri >= 0 && pri < 192 {
+				sv = pri % 8
+				fac = pri / 8
+				msg = msg[e+1:]
+			}
+		}
+	}
+	var t time.Time
+	var host, tag, message string
+	if strings.HasPrefix(msg, "1 ") {
+		t, host, tag, message = parseRFC5424(msg[2:])
+	} else {
+		t, host, tag, message = parseRFC3164(msg, now)
+	}
+	if t.IsZero() {
+		t = now
+	}
+	if host == "" || host == "-" {
+		host = from
+	}
+	if tag == "" {
+		tag = "-"
+	}
+	ts := t.UnixNano()
+	return ts, fmt.Sprintf("%s %s %s %s %s", time.Unix(0, ts).Format(time.RFC3339Nano), host, getSyslogType(sv, fac), tag, message)
+}
+
+// parseRFC5424 : parse TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func parseRFC5424(s string) (time.Time, string, string, string) {
+	var t time.Time
+	a := strings.SplitN(s, " ", 6)
+	if len(a) < 5 {
+		return t, "", "", s
+	}
+	if a[0] != "-" {
+		t, _ = time.Parse(time.RFC3339Nano, a[0])
+	}
+	sd, m := "", ""
+	if len(a) > 5 {
+		sd, m = splitStructuredData(a[5])
+	}
+	msg := []string{}
+	for _, e := range []string{a[3], a[4], strings.TrimPrefix(m, "\ufeff"), sd} {
+		if e != "" && e != "-" {
+			msg = append(msg, e)
+		}
+	}
+	return t, a[1], a[2], strings.Join(msg, " ")
+}
+
+func splitStructuredData(s string) (string, string) {
+	if strings.HasPrefix(s, "-") {
+		return "", strings.TrimPrefix(s[1:], " ")
+	}
+	if !strings.HasPrefix(s, "[") {
+		return "", s
+	}
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case ']':
+			if !inQuote && (i+1 == len(s) || s[i+1] != '[') {
+				return s[:i+1], strings.TrimPrefix(s[i+1:], " ")
+			}
+		}
+	}
+	return s, ""
+}
+
+// parseRFC3164 : parse TIMESTAMP HOSTNAME TAG: MSG.
+// The timestamp has no year, so the log in the future is the log of last year.
+func parseRFC3164(s string, now time.Time) (time.Time, string, string, string) {
+	var t time.Time
+	loc := time.Local
+	if utc {
+		loc = time.UTC
+	}
+	if len(s) >= 15 {
+		if pt, err := time.ParseInLocation("Jan _2 15:04:05", s[:15], loc); err == nil {
+			t = time.Date(now.Year(), pt.Month(), pt.Day(), pt.Hour(), pt.Minute(), pt.Second(), 0, loc)
+			if t.After(now.Add(time.Hour * 24)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			s = strings.TrimLeft(s[15:], " ")
+		}
+	}
+	if t.IsZero() {
+		a := strings.SplitN(s, " ", 2)
+		pt, err := time.Parse(time.RFC3339Nano, a[0])
+		if err != nil || len(a) < 2 {
+			return t, "", "", s
+		}
+		t = pt
+		s = a[1]
+	}
+	a := strings.SplitN(s, " ", 2)
+	if len(a) < 2 {
+		return t, a[0], "", ""
+	}
+	host, s := a[0], a[1]
+	a = strings.SplitN(s, " ", 2)
+	if strings.HasSuffix(a[0], ":") {
+		if len(a) < 2 {
+			return t, host, strings.TrimSuffix(a[0], ":"), ""
+		}
+		return t, host, strings.TrimSuffix(a[0], ":"), a[1]
+	}
+	return t, host, "", s
+}
+
+// getSyslogTLSConfig : load certificate or make self signed certificate
+func getSyslogTLSConfig() (*tls.Config, error) {
+	if syslogTLSCert != "" || syslogTLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(syslogTLSCert, syslogTLSKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "twsla"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, nil
+}
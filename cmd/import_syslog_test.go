@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	utc = true
+	defer func() {
+		utc = false
+	}()
+	now := time.Date(2025, 1, 1, 0, 10, 0, 0, time.UTC)
+	tests := []struct {
+		msg  string
+		time time.Time
+		want string
+	}{
+		{
+			msg:  "<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			time: time.Date(2024, 10, 11, 22, 14, 15, 0, time.UTC),
+			want: "mymachine crit:auth su 'su root' failed for lonvick on /dev/pts/8",
+		},
+		{
+			msg:  "<86>Dec 31 23:59:59 host sshd[123]: Accepted password for root",
+			time: time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			want: "host info:authpriv sshd[123] Accepted password for root",
+		},
+		{
+			msg:  "<13>Jan  1 00:05:00 host test message",
+			time: time.Date(2025, 1, 1, 0, 5, 0, 0, time.UTC),
+			want: "host notice:user - test message",
+		},
+		{
+			msg:  `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application]" eventID="1011"] An application event`,
+			time: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+			want: `mymachine.example.com notice:local4 evntslog ID47 An application event [exampleSDID@32473 iut="3" eventSource="Application]" eventID="1011"]`,
+		},
+		{
+			msg:  "<14>1 - - app 10 - - hello",
+			time: now,
+			want: "192.168.1.1 info:user app 10 hello",
+		},
+		{
+			msg:  "no header message",
+			time: now,
+			want: "192.168.1.1 unknown:unknown - no header message",
+		},
+	}
+	for _, tt := range tests {
+		ts, l := parseSyslog(tt.msg, "192.168.1.1", now)
+		if ts != tt.time.UnixNano() {
+			t.Errorf("parseSyslog(%q) time got %v, want %v", tt.msg, time.Unix(0, ts).UTC(), tt.time)
+		}
+		want := time.Unix(0, tt.time.UnixNano()).Format(time.RFC3339Nano) + " " + tt.want
+		if l != want {
+			t.Errorf("parseSyslog(%q)\n got %q\nwant %q", tt.msg, l, want)
+		}
+	}
+}
+
+func TestSyslogReceiver(t *testing.T) {
+	importFilter = nil
+	syslogStopLines = 6
+	defer func() {
+		syslogStopLines = 0
+	}()
+	logCh = make(chan *LogEnt, 100)
+	r := newSyslogReceiver("syslog+tcp://127.0.0.1:0")
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	r.wg.Add(2)
+	go r.serveUDP(pc)
+	go r.serveTCP(ln)
+	uc, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uc.Close()
+	fmt.Fprint(uc, "<13>Jan  1 00:05:00 host udp message")
+	time.Sleep(100 * time.Millisecond)
+	tc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+	// Octet counting and new line framing.
+	m := "<13>Jan  1 00:05:00 host octet message"
+	fmt.Fprintf(tc, "%d %s", len(m), m)
+	fmt.Fprint(tc, "<13>Jan  1 00:05:00 host line message1\n<13>Jan  1 00:05:00 host line message2\n")
+	// Line starting with digits is not octet counting
+	fmt.Fprint(tc, "2024-05-01T10:00:00Z host digit message\n12 host items\n")
+	select {
+	case <-r.done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("receiver is not stopped by lines")
+	}
+	pc.Close()
+	ln.Close()
+	r.closeConns()
+	r.wg.Wait()
+	close(logCh)
+	got := []string{}
+	for l := range logCh {
+		got = append(got, l.Log[strings.Index(l.Log, " host ")+1:])
+	}
+	want := []string{
+		"host notice:user - udp message",
+		"host notice:user - octet message",
+		"host notice:user - line message1",
+		"host notice:user - line message2",
+		"host unknown:unknown - digit message",
+		"host items",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("received got %v, want %v", got, want)
+	}
+}
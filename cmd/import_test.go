@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"go.etcd.io/bbolt"
+)
+
+// setupImportTest : open new datastore and reset import settings for test
+func setupImportTest(t *testing.T) {
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	d := db
+	t.Cleanup(func() { d.Close() })
+	if err := setupTimeGrinder(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	teaProg = tea.NewProgram(nil, tea.WithContext(ctx))
+	batchSize = 100
+	timeRange = ""
+	setImportTotal(0, 0, 0)
+}
+
+// runImportTest : run import with log saver and return all logs in datastore
+func runImportTest(f func()) []string {
+	logCh = make(chan *LogEnt, 100)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go logSaver(&wg)
+	f()
+	close(logCh)
+	wg.Wait()
+	r := []string{}
+	scanTestLogs(func(ti int64, k, v []byte) {
+		r = append(r, string(v))
+	})
+	return r
+}
+
+// scanTestLogs : call f for each log in datastore
+func scanTestLogs(f func(ti int64, k, v []byte)) {
+	db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, 0, 1<<62, func(ti int64, k, v []byte) bool {
+			f(ti, k, v)
+			return true
+		})
+	})
+}
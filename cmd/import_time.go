@@ -0,0 +1,314 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/timegrinder"
+	"gopkg.in/yaml.v3"
+)
+
+var timeFormat string
+var timeRegex string
+var timeZone string
+var timeConfig string
+
+// timeSetting : timestamp format and timezone for sources matching pattern
+type timeSetting struct {
+	Pattern string `yaml:"pattern"`
+	Format  string `yaml:"format"`
+	Regex   string `yaml:"regex"`
+	TZ      string `yaml:"tz"`
+}
+
+var timeSettings []timeSetting
+
+// loadTimeConfig : load YAML list of time settings
+//
+//   - pattern: "*cloud*.log"
+//     tz: UTC
+//   - pattern: "fw*.log"
+//     format: "%b %d %H:%M:%S"
+//     tz: Asia/Tokyo
+func loadTimeConfig() error {
+	timeSettings = nil
+	if timeConfig == "" {
+		return nil
+	}
+	b, err := os.ReadFile(timeConfig)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, &timeSettings); err != nil {
+		return fmt.Errorf("%s: %w", timeConfig, err)
+	}
+	for _, s := range timeSettings {
+		if _, err := filepath.Match(s.Pattern, ""); err != nil || s.Pattern == "" {
+			return fmt.Errorf("%s: invalid pattern '%s'", timeConfig, s.Pattern)
+		}
+	}
+	return nil
+}
+
+// getTimeSetting : get time setting of source. Settings of the first matching pattern
+// override --timeFormat, --timeRegex and --tz.
+func getTimeSetting(p string) timeSetting {
+	r := timeSetting{Format: timeFormat, Regex: timeRegex, TZ: timeZone}
+	name := filepath.ToSlash(p)
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		// file in archive
+		name = name[i+1:]
+	}
+	for _, s := range timeSettings {
+		n := path.Base(name)
+		if strings.Contains(s.Pattern, "/") {
+			n = name
+		}
+		if ok, _ := filepath.Match(s.Pattern, n); !ok {
+			continue
+		}
+		if s.Format != "" {
+			r.Format = s.Format
+			r.Regex = s.Regex
+		}
+		if s.TZ != "" {
+			r.TZ = s.TZ
+		}
+		break
+	}
+	return r
+}
+
+// sourceTime : timestamp extractor of source.
+// The year of timestamps without year is decided by the reference time
+// and increased when the month goes from December to January.
+type sourceTime struct {
+	tg       *timegrinder.TimeGrinder
+	proc     timegrinder.Processor
+	procNoYr bool
+	loc      *time.Location
+	ref      time.Time
+	year     int
+	last     time.Month
+	noYear   map[string]bool
+}
+
+// newSourceTime : make timestamp extractor of source. ref is the time of source such as modified time of file.
+func newSourceTime(p string, ref time.Time) (*sourceTime, error) {
+	s := &sourceTime{tg: tg, ref: ref, noYear: make(map[string]bool), loc: time.Local}
+	if utc {
+		s.loc = time.UTC
+	}
+	ts := getTimeSetting(p)
+	if ts.Format == "" && ts.TZ == "" && getImportWorkers() < 2 {
+		return s, nil
+	}
+	// TimeGrinder can not be shared by workers of parallel import
+	var err error
+	if s.tg, err = newTimeGrinder(true); err != nil {
+		return nil, err
+	}
+	if ts.TZ != "" {
+		if s.loc, err = time.LoadLocation(ts.TZ); err != nil {
+			return nil, err
+		}
+		s.tg.SetTimezone(ts.TZ)
+	}
+	if ts.Format != "" {
+		layout := getGoTimeLayout(ts.Format)
+		re := ts.Regex
+		if re == "" {
+			re = getTimeLayoutRegex(layout)
+		}
+		if s.proc, err = timegrinder.NewUserProcessor("source", re, layout); err != nil {
+			return nil, fmt.Errorf("invalid time format '%s': %w", ts.Format, err)
+		}
+		s.procNoYr = !hasYear(layout)
+	}
+	return s, nil
+}
+
+// extract : extract timestamp from log
+func (s *sourceTime) extract(d []byte) (time.Time, bool) {
+	if s.proc != nil {
+		if t, ok, _ := s.proc.Extract(d, s.loc); ok {
+			if s.procNoYr {
+				t = s.fixYear(t)
+			}
+			return t, true
+		}
+	}
+	t, off, name, _ := s.tg.DebugExtract(d)
+	if off < 0 {
+		return t, false
+	}
+	if s.isNoYear(name) {
+		t = s.fixYear(t)
+	}
+	return t, true
+}
+
+func (s *sourceTime) isNoYear(name string) bool {
+	if r, ok := s.noYear[name]; ok {
+		return r
+	}
+	r := false
+	if p, ok := s.tg.GetProcessor(name); ok {
+		// Format of unix time processors is not layout, so only formats with month name are checked.
+		r = strings.Contains(p.Format(), "Jan") && !hasYear(p.Format())
+	}
+	s.noYear[name] = r
+	return r
+}
+
+func hasYear(layout string) bool {
+	return strings.Contains(layout, "06")
+}
+
+// fixYear : set year of timestamp without year
+func (s *sourceTime) fixYear(t time.Time) time.Time {
+	withYear := func(y int) time.Time {
+		return time.Date(y, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+	if s.year == 0 {
+		s.year = s.ref.Year()
+		if withYear(s.year).Sub(s.ref) > 25*time.Hour {
+			s.year--
+		}
+	} else if s.last == time.December && t.Month() == time.January {
+		s.year++
+	}
+	s.last = t.Month()
+	return withYear(s.year)
+}
+
+// getSourceRefTime : get modified time of file or now
+func getSourceRefTime(p string) time.Time {
+	if i := strings.Index(p, ":"); i > 0 {
+		// file in archive has the time of archive
+		if fi, err := os.Stat(p[:i]); err == nil && !fi.IsDir() {
+			return fi.ModTime()
+		}
+	}
+	if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+		return fi.ModTime()
+	}
+	return time.Now()
+}
+
+var strftimeLayout = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03",
+	'M': "04", 'S': "05", 'b': "Jan", 'h': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'p': "PM", 'z': "-0700", 'Z': "MST", 'j': "002", 'f': "000000", 'L': "000",
+	'T': "15:04:05", 'F': "2006-01-02", 'D': "01/02/06", '%': "%",
+}
+
+// getGoTimeLayout : convert strftime format to Go layout. Go layout is returned as it is.
+func getGoTimeLayout(f string) string {
+	if !strings.Contains(f, "%") {
+		return f
+	}
+	r := ""
+	for i := 0; i < len(f); i++ {
+		if f[i] == '%' && i+1 < len(f) {
+			if l, ok := strftimeLayout[f[i+1]]; ok {
+				r += l
+				i++
+				continue
+			}
+		}
+		r += string(f[i])
+	}
+	return r
+}
+
+// Go layout elements and regex. Longer elements are first.
+var timeLayoutRegex = [][2]string{
+	{"January", `[A-Z][a-z]+`},
+	{"Monday", `[A-Z][a-z]+`},
+	{"Z07:00", `(?:Z|[-+]\d\d:\d\d)`},
+	{"-07:00", `[-+]\d\d:\d\d`},
+	{"-0700", `[-+]\d{4}`},
+	{"Z0700", `(?:Z|[-+]\d{4})`},
+	{"2006", `\d{4}`},
+	{"Jan", `[A-Z][a-z]{2}`},
+	{"Mon", `[A-Z][a-z]{2}`},
+	{"MST", `[A-Z]{2,5}`},
+	{"002", `\d{3}`},
+	{"_2", `[ \d]?\d`},
+	{"01", `\d\d`},
+	{"02", `\d\d`},
+	{"03", `\d\d`},
+	{"04", `\d\d`},
+	{"05", `\d\d`},
+	{"06", `\d\d`},
+	{"15", `\d\d`},
+	{"PM", `[AP]M`},
+	{"pm", `[ap]m`},
+	{"1", `\d{1,2}`},
+	{"2", `\d{1,2}`},
+	{"3", `\d{1,2}`},
+	{"4", `\d{1,2}`},
+	{"5", `\d{1,2}`},
+}
+
+// getTimeLayoutRegex : make regex to find timestamp of Go layout
+func getTimeLayoutRegex(layout string) string {
+	r := ""
+	for i := 0; i < len(layout); {
+		if (layout[i] == '.' || layout[i] == ',') && strings.HasSuffix(layout[:i], "05") {
+			// fractional second
+			j := i + 1
+			for j < len(layout) && (layout[j] == '0' || layout[j] == '9') {
+				j++
+			}
+			if j > i+1 {
+				if layout[i+1] == '9' {
+					r += `(?:[.,]\d+)?`
+				} else {
+					r += fmt.Sprintf(`[.,]\d{%d}`, j-i-1)
+				}
+				i = j
+				continue
+			}
+		}
+		hit := false
+		for _, e := range timeLayoutRegex {
+			if strings.HasPrefix(layout[i:], e[0]) {
+				r += e[1]
+				i += len(e[0])
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			if layout[i] == ' ' {
+				r += `\s+`
+			} else {
+				r += regexp.QuoteMeta(layout[i : i+1])
+			}
+			i++
+		}
+	}
+	return r
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetGoTimeLayout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"%Y-%m-%d %H:%M:%S", "2006-01-02 15:04:05"},
+		{"%b %e %T", "Jan _2 15:04:05"},
+		{"%d/%b/%Y:%H:%M:%S %z", "02/Jan/2006:15:04:05 -0700"},
+		{"02.01.2006 15:04", "02.01.2006 15:04"},
+		{"100%% %Q", "100% %Q"},
+	}
+	for _, tt := range tests {
+		if got := getGoTimeLayout(tt.in); got != tt.want {
+			t.Errorf("getGoTimeLayout(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSourceTimeFormat(t *testing.T) {
+	defer func() { timeFormat, timeRegex, timeZone = "", "", "" }()
+	tests := []struct {
+		format string
+		tz     string
+		log    string
+		want   time.Time
+	}{
+		{"02.01.2006 15:04:05", "UTC", "host1 31.12.2024 23:59:58 login", time.Date(2024, 12, 31, 23, 59, 58, 0, time.UTC)},
+		{"%d/%m/%Y %H:%M:%S,%L", "Asia/Tokyo", "[05/03/2025 10:20:30,123] start", time.Date(2025, 3, 5, 1, 20, 30, 123000000, time.UTC)},
+		{"%Y%m%d-%H%M%S", "UTC", "id=7 ts=20250102-030405 ok", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"", "America/New_York", "2025-07-01 12:00:00 noon", time.Date(2025, 7, 1, 16, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		timeFormat = tt.format
+		timeZone = tt.tz
+		te, err := newSourceTime("test.log", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := te.extract([]byte(tt.log))
+		if !ok {
+			t.Errorf("%q: no timestamp", tt.log)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.log, got.UTC(), tt.want)
+		}
+	}
+	timeFormat = ""
+	timeZone = "Invalid/Zone"
+	if _, err := newSourceTime("test.log", time.Now()); err == nil {
+		t.Error("invalid timezone is accepted")
+	}
+}
+
+func TestTimeConfig(t *testing.T) {
+	defer func() {
+		timeConfig, timeZone = "", ""
+		timeSettings = nil
+	}()
+	timeConfig = filepath.Join(t.TempDir(), "time.yaml")
+	conf := `- pattern: "fw*.log"
+  format: "%b %d %H:%M:%S"
+  tz: Asia/Tokyo
+- pattern: "cloud/*"
+  tz: UTC
+`
+	if err := os.WriteFile(timeConfig, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTimeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	timeZone = "Europe/Paris"
+	tests := []struct {
+		path   string
+		format string
+		tz     string
+	}{
+		{"/var/log/fw1.log", "%b %d %H:%M:%S", "Asia/Tokyo"},
+		{"logs.tar.gz:cloud/app.log", "", "UTC"},
+		{"logs.zip:fw2.log", "%b %d %H:%M:%S", "Asia/Tokyo"},
+		{"/var/log/app.log", "", "Europe/Paris"},
+	}
+	for _, tt := range tests {
+		s := getTimeSetting(tt.path)
+		if s.Format != tt.format || s.TZ != tt.tz {
+			t.Errorf("%s: got %q %q, want %q %q", tt.path, s.Format, s.TZ, tt.format, tt.tz)
+		}
+	}
+}
+
+func TestSourceTimeYear(t *testing.T) {
+	// log file rotated in January has logs of December
+	ref := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	utc = true
+	defer func() { utc = false }()
+	if err := setupTimeGrinder(); err != nil {
+		t.Fatal(err)
+	}
+	te, err := newSourceTime("messages", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := []string{
+		"Dec 31 23:59:58 host sshd[1]: a",
+		"Dec 31 23:59:59 host sshd[1]: b",
+		"Jan  1 00:00:01 host sshd[1]: c",
+	}
+	want := []time.Time{
+		time.Date(2024, 12, 31, 23, 59, 58, 0, time.UTC),
+		time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC),
+	}
+	for i, l := range logs {
+		got, ok := te.extract([]byte(l))
+		if !ok {
+			t.Fatalf("%q: no timestamp", l)
+		}
+		if !got.Equal(want[i]) {
+			t.Errorf("%q: got %v, want %v", l, got, want[i])
+		}
+	}
+}
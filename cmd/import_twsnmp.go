@@ -114,7 +114,7 @@ func importFromTWSNMPSSHSub(st, et int64) int64 {
 		return 0
 	}
 	r := bytes.NewReader(stdout)
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	hash := getSHA1(sv + ":" + cmd)
 	lastTime := int64(0)
 	readBytes := int64(0)
@@ -151,9 +151,8 @@ func importFromTWSNMPSSHSub(st, et int64) int64 {
 			}
 		}
 		readBytes += int64(len(l))
-		totalBytes += int64(len(l))
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, int64(len(l)))
 		if importFilter != nil && !importFilter.MatchString(l) {
 			skipLines++
 			continue
@@ -192,6 +191,7 @@ func importFromTWSNMPSSHSub(st, et int64) int64 {
 			})
 		}
 	}
+	recordSource(sv+":"+cmd, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  false,
 		Path:  sv + ":" + cmd,
@@ -359,7 +359,7 @@ func importEventLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		EndTime:   time.Unix(0, et).Format("15:04"),
 	}
 
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -370,13 +370,12 @@ func importEventLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		teaProg.Send(err)
 		return
 	}
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	for i, l := range r.EventLogs {
 		sl := fmt.Sprintf("%s %s '%s' %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), l.Type, l.NodeName, l.Event)
 		readBytes += int64(len(sl))
-		totalBytes += int64(len(sl))
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, int64(len(sl)))
 		if importFilter != nil && !importFilter.MatchString(sl) {
 			skipLines++
 			continue
@@ -407,6 +406,7 @@ func importEventLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			})
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -425,7 +425,7 @@ func importTrapFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		EndTime:   time.Unix(0, et).Format("15:04"),
 	}
 
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -436,13 +436,12 @@ func importTrapFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		teaProg.Send(err)
 		return
 	}
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	for i, l := range traps {
 		sl := fmt.Sprintf("%s %s %s %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), l.FromAddress, l.TrapType, l.Variables)
 		readBytes += int64(len(sl))
-		totalBytes += int64(len(sl))
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, int64(len(sl)))
 		if importFilter != nil && !importFilter.MatchString(sl) {
 			skipLines++
 			continue
@@ -473,6 +472,7 @@ func importTrapFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			})
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -488,7 +488,7 @@ func importSyslogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		NextTime: st,
 		Filter:   0,
 	}
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -501,16 +501,15 @@ func importSyslogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			teaProg.Send(err)
 			return
 		}
-		totalFiles++
+		addImportTotal(1, 0, 0)
 		readBytes = int64(0)
 		readLines = 0
 		skipLines = 0
 		for _, l := range r.Logs {
 			sl := fmt.Sprintf("%s %s %s: %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), l.Type, l.Tag, l.Message)
 			readBytes += int64(len(sl))
-			totalBytes += int64(len(sl))
 			readLines++
-			totalLines++
+			addImportTotal(0, 1, int64(len(sl)))
 			if importFilter != nil && !importFilter.MatchString(sl) {
 				skipLines++
 				continue
@@ -544,6 +543,7 @@ func importSyslogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			break
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -560,7 +560,7 @@ func importNetFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		Filter:   0,
 	}
 	ipfix := logType == "ipfix"
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -579,7 +579,7 @@ func importNetFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			teaProg.Send(err)
 			return
 		}
-		totalFiles++
+		addImportTotal(1, 0, 0)
 		readBytes = int64(0)
 		readLines = 0
 		skipLines = 0
@@ -591,9 +591,8 @@ func importNetFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			}
 			sl := fmt.Sprintf("%s %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), string(j))
 			readBytes += int64(len(sl))
-			totalBytes += int64(len(sl))
 			readLines++
-			totalLines++
+			addImportTotal(0, 1, int64(len(sl)))
 			if importFilter != nil && !importFilter.MatchString(sl) {
 				skipLines++
 				continue
@@ -627,6 +626,7 @@ func importNetFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			break
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -642,7 +642,7 @@ func importSFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		NextTime: st,
 		Filter:   0,
 	}
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -655,7 +655,7 @@ func importSFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			teaProg.Send(err)
 			return
 		}
-		totalFiles++
+		addImportTotal(1, 0, 0)
 		readBytes = int64(0)
 		readLines = 0
 		skipLines = 0
@@ -667,9 +667,8 @@ func importSFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			}
 			sl := fmt.Sprintf("%s %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), string(j))
 			readBytes += int64(len(sl))
-			totalBytes += int64(len(sl))
 			readLines++
-			totalLines++
+			addImportTotal(0, 1, int64(len(sl)))
 			if importFilter != nil && !importFilter.MatchString(sl) {
 				skipLines++
 				continue
@@ -703,6 +702,7 @@ func importSFlowFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			break
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -718,7 +718,7 @@ func importSFlowCounterFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		NextTime: st,
 		Filter:   0,
 	}
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -731,7 +731,7 @@ func importSFlowCounterFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			teaProg.Send(err)
 			return
 		}
-		totalFiles++
+		addImportTotal(1, 0, 0)
 		readBytes = int64(0)
 		readLines = 0
 		skipLines = 0
@@ -743,9 +743,8 @@ func importSFlowCounterFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			}
 			sl := fmt.Sprintf("%s %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), string(j))
 			readBytes += int64(len(sl))
-			totalBytes += int64(len(sl))
 			readLines++
-			totalLines++
+			addImportTotal(0, 1, int64(len(sl)))
 			if importFilter != nil && !importFilter.MatchString(sl) {
 				skipLines++
 				continue
@@ -779,6 +778,7 @@ func importSFlowCounterFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			break
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -797,7 +797,7 @@ func importArpLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		EndTime:   time.Unix(0, et).Format("15:04"),
 	}
 
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -808,7 +808,7 @@ func importArpLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		teaProg.Send(err)
 		return
 	}
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	for i, l := range arpLogs {
 		j, err := json.Marshal(&l)
 		if err != nil {
@@ -817,9 +817,8 @@ func importArpLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		}
 		sl := fmt.Sprintf("%s %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), string(j))
 		readBytes += int64(len(sl))
-		totalBytes += int64(len(sl))
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, int64(len(sl)))
 		if importFilter != nil && !importFilter.MatchString(sl) {
 			skipLines++
 			continue
@@ -850,6 +849,7 @@ func importArpLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			})
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
@@ -873,7 +873,7 @@ func importPollingLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		EndTime:   time.Unix(0, et).Format("15:04"),
 	}
 
-	hash := getSHA1(source)
+	hash := newSourceID(source+" "+logType, source)
 	lastTime := int64(0)
 	readBytes := int64(0)
 	readLines := 0
@@ -884,7 +884,7 @@ func importPollingLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		teaProg.Send(err)
 		return
 	}
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	for i, l := range logs {
 		j, err := json.Marshal(&l)
 		if err != nil {
@@ -893,9 +893,8 @@ func importPollingLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 		}
 		sl := fmt.Sprintf("%s %s", time.Unix(0, l.Time).Format(time.RFC3339Nano), string(j))
 		readBytes += int64(len(sl))
-		totalBytes += int64(len(sl))
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, int64(len(sl)))
 		if importFilter != nil && !importFilter.MatchString(sl) {
 			skipLines++
 			continue
@@ -926,6 +925,7 @@ func importPollingLogFromTWSNMPByAPI(c *client.TWSNMPApi) {
 			})
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  true,
 		Path:  path,
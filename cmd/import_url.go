@@ -0,0 +1,397 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// URL sources
+//
+// http:// and https:// download a file with headers and basic auth of URL.
+// s3://bucket/key imports an object, and s3://bucket/prefix/ imports
+// objects under the prefix of S3 compatible storage.
+// Compressed files and archives are walked by walkArchive.
+// Requests are canceled when the server does not respond for --httpTimeout.
+
+var httpHeaders []string
+var s3Endpoint string
+var s3Region string
+var httpTimeout int
+
+func importFromHTTP() {
+	req, err := newHTTPRequest(source)
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	path := redactURL(source)
+	res, err := doHTTPRequest(req)
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		teaProg.Send(fmt.Errorf("%s: %s", path, res.Status))
+		return
+	}
+	if err := walkArchive(path, res.Body, getSimpleFilter(filePat), importArchiveEnt); err != nil {
+		teaProg.Send(err)
+	}
+}
+
+// newHTTPRequest : make GET request with --header and basic auth of URL
+func newHTTPRequest(s string) (*http.Request, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	user := u.User
+	u.User = nil
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range httpHeaders {
+		a := strings.SplitN(h, ":", 2)
+		if len(a) != 2 {
+			return nil, fmt.Errorf("invalid header %s", h)
+		}
+		req.Header.Add(strings.TrimSpace(a[0]), strings.TrimSpace(a[1]))
+	}
+	if user != nil {
+		pass, _ := user.Password()
+		req.SetBasicAuth(user.Username(), pass)
+	}
+	return req, nil
+}
+
+// doHTTPRequest : send request that is canceled when connect, response or read of body
+// stops for --httpTimeout. Download of large file is not limited while data is received.
+func doHTTPRequest(req *http.Request) (*http.Response, error) {
+	if httpTimeout <= 0 {
+		return http.DefaultClient.Do(req)
+	}
+	d := time.Duration(httpTimeout) * time.Second
+	ctx, cancel := context.WithCancel(req.Context())
+	t := time.AfterFunc(d, cancel)
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Stop()
+		cancel()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: no response in %v", redactURL(req.URL.String()), d)
+		}
+		return nil, err
+	}
+	t.Reset(d)
+	res.Body = &idleTimeoutBody{ReadCloser: res.Body, timer: t, timeout: d, cancel: cancel}
+	return res, nil
+}
+
+// idleTimeoutBody : body of response that cancels request when read stops
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	if errors.Is(err, context.Canceled) {
+		err = fmt.Errorf("no data in %v", b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func importFromS3() {
+	u, err := url.Parse(source)
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	c := newS3Client(u)
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	filter := getSimpleFilter(filePat)
+	if key != "" && !strings.HasSuffix(key, "/") && filter == nil {
+		if err := c.importObject(bucket, key); err != nil {
+			teaProg.Send(err)
+		}
+		return
+	}
+	objs, err := c.list(bucket, key)
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	for _, o := range objs {
+		if stopImport {
+			return
+		}
+		if strings.HasSuffix(o.Key, "/") || (filter != nil && !filter.MatchString(path.Base(o.Key))) {
+			continue
+		}
+		if err := c.importObject(bucket, o.Key); err != nil {
+			teaProg.Send(err)
+			return
+		}
+	}
+}
+
+type s3Client struct {
+	endpoint *url.URL
+	// path style is bucket in path like http://minio:9000/bucket/key
+	pathStyle bool
+	region    string
+	key       string
+	secret    string
+	token     string
+	now       func() time.Time
+}
+
+// newS3Client : make client of S3 compatible storage. Credentials are
+// user and password of URL or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+// Requests are not signed without credentials.
+func newS3Client(u *url.URL) *s3Client {
+	c := &s3Client{
+		region: s3Region,
+		key:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:  os.Getenv("AWS_SESSION_TOKEN"),
+		now:    time.Now,
+	}
+	if u.User != nil {
+		c.key = u.User.Username()
+		c.secret, _ = u.User.Password()
+		c.token = ""
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	ep := s3Endpoint
+	if ep == "" {
+		ep = os.Getenv("AWS_ENDPOINT_URL_S3")
+	}
+	if ep == "" {
+		ep = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if ep != "" {
+		c.endpoint, _ = url.Parse(strings.TrimSuffix(ep, "/"))
+	}
+	if c.endpoint == nil || c.endpoint.Host == "" {
+		c.endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", c.region)}
+	} else {
+		c.pathStyle = true
+	}
+	return c
+}
+
+// objectURL : make URL of object. query must be canonical.
+func (c *s3Client) objectURL(bucket, key, query string) string {
+	u := *c.endpoint
+	p := "/" + s3Escape(key, true)
+	if c.pathStyle {
+		p = strings.TrimSuffix(u.Path, "/") + "/" + bucket + p
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	return u.Scheme + "://" + u.Host + p + "?" + query
+}
+
+func (c *s3Client) get(bucket, key string, query url.Values) (*http.Response, error) {
+	q := s3CanonicalQuery(query)
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.objectURL(bucket, key, q), "?"), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req)
+	res, err := doHTTPRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		var e struct {
+			Code    string
+			Message string
+		}
+		if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("s3://%s/%s: %s %s", bucket, key, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("s3://%s/%s: %s", bucket, key, res.Status)
+	}
+	return res, nil
+}
+
+type s3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// list : list objects under prefix
+func (c *s3Client) list(bucket, prefix string) ([]s3Object, error) {
+	r := []s3Object{}
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		res, err := c.get(bucket, "", q)
+		if err != nil {
+			return nil, err
+		}
+		var l struct {
+			Contents              []s3Object
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&l)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3://%s/%s: %w", bucket, prefix, err)
+		}
+		r = append(r, l.Contents...)
+		if !l.IsTruncated || l.NextContinuationToken == "" {
+			return r, nil
+		}
+		token = l.NextContinuationToken
+	}
+}
+
+// importObject : import object. -p filter is also used for archive entries.
+func (c *s3Client) importObject(bucket, key string) error {
+	res, err := c.get(bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return walkArchive("s3://"+bucket+"/"+key, res.Body, getSimpleFilter(filePat), importArchiveEnt)
+}
+
+const s3EmptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign : sign request by AWS signature version 4
+func (c *s3Client) sign(req *http.Request) {
+	if c.key == "" {
+		return
+	}
+	t := c.now().UTC()
+	date := t.Format("20060102")
+	amzDate := t.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", s3EmptyHash)
+	if c.token != "" {
+		req.Header.Set("x-amz-security-token", c.token)
+	}
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if c.token != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	ch := ""
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		ch += h + ":" + strings.TrimSpace(v) + "\n"
+	}
+	signed := strings.Join(headers, ";")
+	cr := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		ch,
+		signed,
+		s3EmptyHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	h := sha256.Sum256([]byte(cr))
+	sts := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+	k := s3HMAC([]byte("AWS4"+c.secret), date)
+	k = s3HMAC(k, c.region)
+	k = s3HMAC(k, "s3")
+	k = s3HMAC(k, "aws4_request")
+	sig := hex.EncodeToString(s3HMAC(k, sts))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s", c.key, scope, signed, sig))
+}
+
+func s3HMAC(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// s3Escape : URI encode of AWS signature. / is not encoded in path.
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (path && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	a := []string{}
+	for k, vs := range q {
+		for _, v := range vs {
+			a = append(a, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	sort.Strings(a)
+	return strings.Join(a, "&")
+}
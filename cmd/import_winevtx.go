@@ -16,17 +16,27 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/0xrawsec/golang-evtx/evtx"
 )
 
+var evtxEventIDs string
+var evtxChannel string
+var evtxProvider string
+var evtxFields string
+
 type winLogEnt struct {
 	Name   string
 	String bool
-	Path   evtx.GoEvtxPath
+	// Any is value of any type like user defined fields
+	Any  bool
+	Path evtx.GoEvtxPath
 }
 
 var winLogList = []winLogEnt{
@@ -40,8 +50,180 @@ var winLogList = []winLogEnt{
 	{Name: "UserID", Path: evtx.UserIDPath, String: true},
 }
 
-func importFromWindowsEvtx(path string) {
-	r, err := os.Open(path)
+// evtxFilter : filter of events by EventID, Channel and Provider
+type evtxFilter struct {
+	ids       map[int64]bool
+	channels  map[string]bool
+	providers map[string]bool
+}
+
+var evtxProviderPath = evtx.Path("/Event/System/Provider/Name")
+
+// newEvtxFilter : make filter from --evtxEventIDs like 4624,4625 or 4624-4634,
+// --evtxChannel and --evtxProvider. Channel and Provider are not case sensitive.
+func newEvtxFilter() (*evtxFilter, error) {
+	if evtxEventIDs == "" && evtxChannel == "" && evtxProvider == "" {
+		return nil, nil
+	}
+	f := &evtxFilter{}
+	for _, id := range strings.Split(evtxEventIDs, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if f.ids == nil {
+			f.ids = make(map[int64]bool)
+		}
+		a := strings.SplitN(id, "-", 2)
+		s, err := strconv.ParseInt(a[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event id %s", id)
+		}
+		e := s
+		if len(a) == 2 {
+			if e, err = strconv.ParseInt(a[1], 10, 64); err != nil || e < s || e-s > 0xffff {
+				return nil, fmt.Errorf("invalid event id %s", id)
+			}
+		}
+		for i := s; i <= e; i++ {
+			f.ids[i] = true
+		}
+	}
+	f.channels = getEvtxNameSet(evtxChannel)
+	f.providers = getEvtxNameSet(evtxProvider)
+	return f, nil
+}
+
+func getEvtxNameSet(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+	r := make(map[string]bool)
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			r[strings.ToLower(n)] = true
+		}
+	}
+	return r
+}
+
+// match : check event before rendering line
+func (f *evtxFilter) match(e *evtx.GoEvtxMap) bool {
+	if f == nil {
+		return true
+	}
+	if f.ids != nil {
+		id, err := e.GetInt(&evtx.EventIDPath)
+		if err != nil {
+			id, err = e.GetInt(&evtx.EventIDPath2)
+		}
+		if err != nil || !f.ids[id] {
+			return false
+		}
+	}
+	if f.channels != nil {
+		if c, err := e.GetString(&evtx.ChannelPath); err != nil || !f.channels[strings.ToLower(c)] {
+			return false
+		}
+	}
+	if f.providers != nil {
+		if p, err := e.GetString(&evtxProviderPath); err != nil || !f.providers[strings.ToLower(p)] {
+			return false
+		}
+	}
+	return true
+}
+
+// getEvtxFields : get summary fields from --evtxFields like
+// EventID,User=/Event/EventData/TargetUserName,/Event/EventData/IpAddress
+// Name of path is the last element. Names in default summary can be used without path.
+func getEvtxFields(s string) ([]winLogEnt, error) {
+	if s == "" {
+		return winLogList, nil
+	}
+	r := []winLogEnt{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(f, "=")
+		if !ok {
+			name, path = "", f
+		}
+		if !strings.HasPrefix(path, "/") {
+			found := false
+			for _, w := range winLogList {
+				if w.Name == path {
+					if name != "" {
+						w.Name = name
+					}
+					r = append(r, w)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("invalid evtx field %s", f)
+			}
+			continue
+		}
+		p := evtx.Path(path)
+		if name == "" {
+			name = p[len(p)-1]
+		}
+		r = append(r, winLogEnt{Name: name, Any: true, Path: p})
+	}
+	return r, nil
+}
+
+// getEvtxSummary : make summary line of event
+func getEvtxSummary(e *evtx.GoEvtxMap, t time.Time, fields []winLogEnt) string {
+	a := []string{t.Format("2006-01-02T15:04:05.000")}
+	done := make(map[string]bool)
+	for _, w := range fields {
+		if done[w.Name] {
+			continue
+		}
+		switch {
+		case w.Any:
+			if v, err := e.Get(&w.Path); err == nil {
+				a = append(a, fmt.Sprintf("%s=%s", w.Name, getEvtxValueStr(*v)))
+				done[w.Name] = true
+			}
+		case w.String:
+			if s, err := e.GetString(&w.Path); err == nil {
+				a = append(a, fmt.Sprintf("%s=%s", w.Name, s))
+				done[w.Name] = true
+			}
+		default:
+			if v, err := e.GetInt(&w.Path); err == nil {
+				a = append(a, fmt.Sprintf("%s=%d", w.Name, v))
+				done[w.Name] = true
+			}
+		}
+	}
+	return strings.Join(a, " ")
+}
+
+// getEvtxValueStr : value of user defined field. Map is JSON and string with space is quoted.
+func getEvtxValueStr(v evtx.GoEvtxElement) string {
+	switch v := v.(type) {
+	case string:
+		if strings.ContainsAny(v, " \t\r\n\"") {
+			return strconv.Quote(v)
+		}
+		return v
+	case evtx.GoEvtxMap, map[string]interface{}, []interface{}:
+		if j, err := json.Marshal(v); err == nil {
+			return string(j)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// importFromWindowsEvtx : import evtx. file is the local file of path.
+func importFromWindowsEvtx(path, file string) {
+	r, err := os.Open(file)
 	if err != nil {
 		teaProg.Send(err)
 		return
@@ -58,8 +240,18 @@ func importFromWindowsEvtx(path string) {
 			return
 		}
 	}
-	summary := logType == "summary"
-	totalFiles++
+	summary := logType == "summary" || evtxFields != ""
+	fields, err := getEvtxFields(evtxFields)
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	filter, err := newEvtxFilter()
+	if err != nil {
+		teaProg.Send(err)
+		return
+	}
+	addImportTotal(1, 0, 0)
 	hash := getSHA1(path)
 	readBytes := int64(0)
 	st, et := getTimeRange()
@@ -85,7 +277,11 @@ func importFromWindowsEvtx(path string) {
 			continue
 		}
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, 0)
+		if !filter.match(e) {
+			skipLines++
+			continue
+		}
 		syst, err := e.GetTime(&evtx.SystemTimePath)
 		if err != nil {
 			skipLines++
@@ -96,23 +292,10 @@ func importFromWindowsEvtx(path string) {
 		if !summary {
 			l = string(evtx.ToJSON(e))
 		} else {
-			a := []string{}
-			a = append(a, syst.Format("2006-01-02T15:04:05.000"))
-			for _, w := range winLogList {
-				if w.String {
-					if s, err := e.GetString(&w.Path); err == nil {
-						a = append(a, fmt.Sprintf("%s=%s", w.Name, s))
-					}
-				} else {
-					if v, err := e.GetInt(&w.Path); err == nil {
-						a = append(a, fmt.Sprintf("%s=%d", w.Name, v))
-					}
-				}
-			}
-			l = strings.Join(a, " ")
+			l = getEvtxSummary(e, syst, fields)
 		}
 		readBytes += int64(len(l))
-		totalBytes += int64(len(l))
+		addImportTotal(0, 0, int64(len(l)))
 		if importFilter != nil && !importFilter.MatchString(l) {
 			skipLines++
 			continue
@@ -128,6 +311,7 @@ func importFromWindowsEvtx(path string) {
 			Line: readLines,
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	teaProg.Send(ImportMsg{
 		Done:  false,
 		Path:  path,
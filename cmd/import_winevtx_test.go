@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xrawsec/golang-evtx/evtx"
+)
+
+func testEvtxEvent(id, channel, provider string, data evtx.GoEvtxMap) *evtx.GoEvtxMap {
+	return &evtx.GoEvtxMap{
+		"Event": evtx.GoEvtxMap{
+			"System": evtx.GoEvtxMap{
+				"EventID":       id,
+				"EventRecordID": "100",
+				"Channel":       channel,
+				"Computer":      "pc1",
+				"Provider":      evtx.GoEvtxMap{"Name": provider},
+			},
+			"EventData": data,
+		},
+	}
+}
+
+func TestEvtxFilter(t *testing.T) {
+	defer func() { evtxEventIDs, evtxChannel, evtxProvider = "", "", "" }()
+	logon := testEvtxEvent("4624", "Security", "Microsoft-Windows-Security-Auditing", nil)
+	failed := testEvtxEvent("4625", "Security", "Microsoft-Windows-Security-Auditing", nil)
+	sysmon := &evtx.GoEvtxMap{
+		"Event": evtx.GoEvtxMap{
+			"System": evtx.GoEvtxMap{
+				"EventID":  evtx.GoEvtxMap{"Value": "1", "Qualifiers": "0"},
+				"Channel":  "Microsoft-Windows-Sysmon/Operational",
+				"Provider": evtx.GoEvtxMap{"Name": "Microsoft-Windows-Sysmon"},
+			},
+		},
+	}
+	tests := []struct {
+		ids, channel, provider string
+		want                   []bool
+	}{
+		{"", "", "", []bool{true, true, true}},
+		{"4624", "", "", []bool{true, false, false}},
+		{"1, 4625", "", "", []bool{false, true, true}},
+		{"4620-4624", "", "", []bool{true, false, false}},
+		{"", "security", "", []bool{true, true, false}},
+		{"", "", "Microsoft-Windows-Sysmon,other", []bool{false, false, true}},
+		{"4625", "Security", "microsoft-windows-security-auditing", []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		evtxEventIDs, evtxChannel, evtxProvider = tt.ids, tt.channel, tt.provider
+		f, err := newEvtxFilter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range []*evtx.GoEvtxMap{logon, failed, sysmon} {
+			if got := f.match(e); got != tt.want[i] {
+				t.Errorf("ids=%q channel=%q provider=%q event %d = %v", tt.ids, tt.channel, tt.provider, i, got)
+			}
+		}
+	}
+	for _, ids := range []string{"abc", "4625-4624", "1-100000"} {
+		evtxEventIDs = ids
+		if _, err := newEvtxFilter(); err == nil {
+			t.Errorf("invalid event ids %q is accepted", ids)
+		}
+	}
+}
+
+func TestEvtxSummary(t *testing.T) {
+	e := testEvtxEvent("4624", "Security", "Microsoft-Windows-Security-Auditing", evtx.GoEvtxMap{
+		"TargetUserName": "alice",
+		"IpAddress":      "10.0.0.5",
+		"LogonProcess":   "User32 ",
+	})
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		fields string
+		want   string
+	}{
+		{"", "2024-05-01T10:00:00.000 EventID=4624 RecordID=100 Channel=Security Provider=Microsoft-Windows-Security-Auditing Computer=pc1"},
+		{"EventID,User=/Event/EventData/TargetUserName,/Event/EventData/IpAddress", "2024-05-01T10:00:00.000 EventID=4624 User=alice IpAddress=10.0.0.5"},
+		{"ID=EventID,/Event/EventData/LogonProcess,/Event/EventData/None", `2024-05-01T10:00:00.000 ID=4624 LogonProcess="User32 "`},
+		{"/Event/System/Provider", `2024-05-01T10:00:00.000 Provider={"Name":"Microsoft-Windows-Security-Auditing"}`},
+	}
+	for _, tt := range tests {
+		f, err := getEvtxFields(tt.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getEvtxSummary(e, ts, f); got != tt.want {
+			t.Errorf("fields %q got %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+	if _, err := getEvtxFields("EventID,Unknown"); err == nil {
+		t.Error("unknown field is accepted")
+	}
+}
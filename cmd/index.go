@@ -0,0 +1,321 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"go.etcd.io/bbolt"
+)
+
+// Token index
+//
+// The index bucket has one nested bucket per token.
+// Each token bucket has the keys of the logs that contain the token.
+// The index is used only when the meta bucket marks it as complete.
+
+var buildIndex bool
+
+// simpleFilterList : positive simple filters used by index search
+var simpleFilterList []string
+
+const (
+	termExact = iota
+	termPrefix
+	termSuffix
+	termContains
+)
+
+type indexTerm struct {
+	Word string
+	Mode int
+}
+
+func isTokenChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// getTokens : get unique tokens from log for index
+func getTokens(l string) []string {
+	m := make(map[string]bool)
+	r := []string{}
+	for _, t := range strings.FieldsFunc(l, func(c rune) bool { return !isTokenChar(c) }) {
+		if len(t) < 2 || m[t] {
+			continue
+		}
+		m[t] = true
+		r = append(r, t)
+	}
+	return r
+}
+
+// getIndexTerms : get index terms from simple filter
+func getIndexTerms(f string) []indexTerm {
+	r := []indexTerm{}
+	if f == "" || strings.HasPrefix(f, "#") {
+		return r
+	}
+	f = strings.TrimSuffix(f, "$")
+	for _, seg := range strings.FieldsFunc(f, func(c rune) bool { return c == '*' || c == '?' }) {
+		rs := []rune(seg)
+		for i := 0; i < len(rs); {
+			if !isTokenChar(rs[i]) {
+				i++
+				continue
+			}
+			s := i
+			for i < len(rs) && isTokenChar(rs[i]) {
+				i++
+			}
+			w := string(rs[s:i])
+			if len(w) < 2 {
+				continue
+			}
+			left := s > 0
+			right := i < len(rs)
+			mode := termContains
+			switch {
+			case left && right:
+				mode = termExact
+			case left:
+				mode = termPrefix
+			case right:
+				mode = termSuffix
+			}
+			r = append(r, indexTerm{Word: w, Mode: mode})
+		}
+	}
+	return r
+}
+
+func isIndexed(tx *bbolt.Tx) bool {
+	return getMeta(tx, "index") == "1"
+}
+
+// addIndex : add log key to token buckets
+func addIndex(tx *bbolt.Tx, id []byte, l string) error {
+	bi, err := tx.CreateBucketIfNotExists([]byte("index"))
+	if err != nil {
+		return err
+	}
+	for _, t := range getTokens(l) {
+		b, err := bi.CreateBucketIfNotExists([]byte(t))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(id, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delIndex : delete log key from token buckets
+func delIndex(tx *bbolt.Tx, id []byte, l string) error {
+	bi := tx.Bucket([]byte("index"))
+	if bi == nil {
+		return nil
+	}
+	for _, t := range getTokens(l) {
+		b := bi.Bucket([]byte(t))
+		if b == nil {
+			continue
+		}
+		if err := b.Delete(id); err != nil {
+			return err
+		}
+		if k, _ := b.Cursor().First(); k == nil {
+			if err := bi.DeleteBucket([]byte(t)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setupIndex : build index for logs already in datastore
+func setupIndex() error {
+	indexed := false
+	db.View(func(tx *bbolt.Tx) error {
+		indexed = isIndexed(tx)
+		return nil
+	})
+	if indexed {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "Building index...")
+	var lk []byte
+	for {
+		n := 0
+		if err := db.Update(func(tx *bbolt.Tx) error {
+			sk := []byte{}
+			if lk != nil {
+				sk = append(append([]byte{}, lk...), 0)
+			}
+			var err error
+			serr := newLogStore(tx).seek(sk, func(k, v []byte) bool {
+				if n >= batchSize {
+					return false
+				}
+				if err = addIndex(tx, k, string(v)); err != nil {
+					return false
+				}
+				lk = append(lk[:0], k...)
+				n++
+				return true
+			})
+			if serr != nil {
+				return serr
+			}
+			if err != nil {
+				return err
+			}
+			if n < batchSize {
+				return setMeta(tx, "index", "1")
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
+
+// maxIndexCandidates : sequential scan is faster than reading many candidates one by one
+var maxIndexCandidates = 100000
+
+// maxPrefixTokens : prefix term that matches many tokens is not used for index
+const maxPrefixTokens = 1000
+
+// keyIter : iterator of sorted log keys in time range of token buckets.
+// Keys of prefix term are merged from the buckets of tokens.
+type keyIter struct {
+	curs []*bbolt.Cursor
+	keys [][]byte
+	ek   []byte
+}
+
+func newKeyIter(buckets []*bbolt.Bucket, sk, ek []byte) *keyIter {
+	it := &keyIter{ek: ek}
+	for _, b := range buckets {
+		c := b.Cursor()
+		k, _ := c.Seek(sk)
+		if k != nil && bytes.Compare(k, ek) >= 0 {
+			k = nil
+		}
+		it.curs = append(it.curs, c)
+		it.keys = append(it.keys, k)
+	}
+	return it
+}
+
+// seek : get the first key that is equal to or greater than k. Returns nil at end.
+func (it *keyIter) seek(k []byte) []byte {
+	var r []byte
+	for i, c := range it.curs {
+		if it.keys[i] != nil && bytes.Compare(it.keys[i], k) < 0 {
+			it.keys[i], _ = c.Seek(k)
+			if it.keys[i] != nil && bytes.Compare(it.keys[i], it.ek) >= 0 {
+				it.keys[i] = nil
+			}
+		}
+		if it.keys[i] != nil && (r == nil || bytes.Compare(it.keys[i], r) < 0) {
+			r = it.keys[i]
+		}
+	}
+	return r
+}
+
+// getIndexCandidates : get candidate log keys by token index.
+// Only exact and prefix terms are used, because suffix and contains terms need to check all tokens.
+// Returns false if index can not be used for current filter or has too many candidates.
+func getIndexCandidates(tx *bbolt.Tx, sti, eti int64) ([]string, bool) {
+	if !isIndexed(tx) {
+		return nil, false
+	}
+	bi := tx.Bucket([]byte("index"))
+	if bi == nil {
+		return nil, false
+	}
+	sk := []byte(fmt.Sprintf("%016x:", sti))
+	ek := []byte(fmt.Sprintf("%016x;", eti))
+	its := []*keyIter{}
+	for _, f := range simpleFilterList {
+		for _, t := range getIndexTerms(f) {
+			buckets := []*bbolt.Bucket{}
+			switch t.Mode {
+			case termExact:
+				if b := bi.Bucket([]byte(t.Word)); b != nil {
+					buckets = append(buckets, b)
+				}
+			case termPrefix:
+				c := bi.Cursor()
+				for k, v := c.Seek([]byte(t.Word)); k != nil && bytes.HasPrefix(k, []byte(t.Word)); k, v = c.Next() {
+					if v != nil {
+						continue
+					}
+					if b := bi.Bucket(k); b != nil {
+						buckets = append(buckets, b)
+					}
+					if len(buckets) > maxPrefixTokens {
+						break
+					}
+				}
+				if len(buckets) > maxPrefixTokens {
+					continue
+				}
+			default:
+				continue
+			}
+			its = append(its, newKeyIter(buckets, sk, ek))
+		}
+	}
+	if len(its) < 1 {
+		return nil, false
+	}
+	// Intersect sorted keys by seeking all iterators to the largest key
+	r := []string{}
+	k := its[0].seek(sk)
+	for k != nil {
+		match := true
+		for _, it := range its {
+			nk := it.seek(k)
+			if nk == nil {
+				return r, true
+			}
+			if !bytes.Equal(nk, k) {
+				k = nk
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if len(r) >= maxIndexCandidates {
+			return nil, false
+		}
+		r = append(r, string(k))
+		k = its[0].seek(append(append([]byte{}, k...), 0))
+	}
+	return r, true
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestGetIndexTerms(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []indexTerm
+	}{
+		{"fail", []indexTerm{{Word: "fail", Mode: termContains}}},
+		{"connection refused", []indexTerm{{Word: "connection", Mode: termSuffix}, {Word: "refused", Mode: termPrefix}}},
+		{"a user root from", []indexTerm{{Word: "user", Mode: termExact}, {Word: "root", Mode: termExact}, {Word: "from", Mode: termPrefix}}},
+		{"err*disk", []indexTerm{{Word: "err", Mode: termContains}, {Word: "disk", Mode: termContains}}},
+		{"#IP", []indexTerm{}},
+		{"a", []indexTerm{}},
+	}
+	for _, tt := range tests {
+		got := getIndexTerms(tt.input)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getIndexTerms(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGetIndexCandidates(t *testing.T) {
+	var err error
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err = openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	batchSize = 100
+	if err = setupIndex(); err != nil {
+		t.Fatal(err)
+	}
+	logs := []logBufEnt{
+		{ID: []byte("0000000000000001:00:1"), Log: []byte("sshd: Failed password for root")},
+		{ID: []byte("0000000000000002:00:2"), Log: []byte("sshd: Accepted password for user1")},
+		{ID: []byte("0000000000000003:00:3"), Log: []byte("kernel: disk failure on sda")},
+	}
+	if err = saveLogs(logs, dataStoreInfo{Indexed: true}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filters []string
+		want    []string
+	}{
+		{[]string{"Failed password"}, []string{"0000000000000001:00:1", "0000000000000002:00:2"}},
+		{[]string{"password for"}, []string{"0000000000000001:00:1", "0000000000000002:00:2"}},
+		{[]string{"password for", "for user"}, []string{"0000000000000002:00:2"}},
+		{[]string{"for root", "a password for"}, []string{"0000000000000001:00:1"}},
+		{[]string{"on sda", "failure on"}, []string{"0000000000000003:00:3"}},
+		{[]string{"for nothing"}, []string{}},
+	}
+	for _, tt := range tests {
+		simpleFilterList = tt.filters
+		db.View(func(tx *bbolt.Tx) error {
+			got, ok := getIndexCandidates(tx, 0, 10)
+			if !ok {
+				t.Errorf("getIndexCandidates(%v) index not used", tt.filters)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getIndexCandidates(%v) = %v, want %v", tt.filters, got, tt.want)
+			}
+			return nil
+		})
+	}
+	// Suffix and contains terms and too many candidates use sequential scan
+	defer func() { maxIndexCandidates = 100000 }()
+	for _, f := range [][]string{{"fail"}, {"err*disk"}, {"password for"}} {
+		if f[0] == "password for" {
+			maxIndexCandidates = 1
+		}
+		simpleFilterList = f
+		db.View(func(tx *bbolt.Tx) error {
+			if _, ok := getIndexCandidates(tx, 0, 10); ok {
+				t.Errorf("getIndexCandidates(%v) index used", f)
+			}
+			return nil
+		})
+	}
+	simpleFilterList = nil
+}
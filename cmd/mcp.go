@@ -16,10 +16,7 @@ limitations under the License.
 package cmd
 
 import (
-	"archive/tar"
-	"archive/zip"
 	"bufio"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -28,9 +25,7 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -269,7 +264,7 @@ func addPrompts(s *mcp.Server) {
 			{
 				Name:        "path",
 				Title:       "Log file or directory path to import",
-				Description: "Log file or directory path to import.Files inside archive files such as zip, tar.gz, gz, etc. can be targeted for import.",
+				Description: "Log file or directory path to import.Files inside archive files such as zip, tar, gz, bz2, xz, zst and nested archives can be targeted for import.",
 				Required:    true,
 			},
 			{
@@ -332,35 +327,26 @@ func searchLog(ctx context.Context, req *mcp.CallToolRequest, args searchLogPara
 		limit = 10000
 	}
 	setupFilter([]string{})
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		return nil, nil, err
 	}
 	defer db.Close()
 	results = []string{}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			if matchFilter(&l) {
 				results = append(results, l)
 				if len(results) >= limit {
-					break
+					return false
 				}
 			}
-		}
-		return nil
-	})
+			return true
+		})
+	}); err != nil {
+		return nil, nil, err
+	}
 
 	j, err := json.Marshal(&results)
 	if err != nil {
@@ -486,26 +472,15 @@ func countLog(ctx context.Context, req *mcp.CallToolRequest, args countLogParams
 	if mode == 2 {
 		setupTimeGrinder()
 	}
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		return nil, nil, err
 	}
 	defer db.Close()
 	var countMap = make(map[string]int)
 	intv := int64(getInterval()) * 1000 * 1000 * 1000
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			if matchFilter(&l) {
 				switch mode {
@@ -519,7 +494,7 @@ func countLog(ctx context.Context, req *mcp.CallToolRequest, args countLogParams
 						countMap[ck]++
 					}
 				case 2:
-					ck := normalizeLog(l)
+					ck := normalizeLog(tg, l)
 					countMap[ck]++
 				case 3:
 					// Word
@@ -545,9 +520,11 @@ func countLog(ctx context.Context, req *mcp.CallToolRequest, args countLogParams
 					countMap[ck]++
 				}
 			}
-		}
-		return nil
-	})
+			return true
+		})
+	}); err != nil {
+		return nil, nil, err
+	}
 	cl := []mcpCountEnt{}
 	for k, v := range countMap {
 		cl = append(cl, mcpCountEnt{
@@ -646,25 +623,14 @@ func extractDataFromLog(ctx context.Context, req *mcp.CallToolRequest, args extr
 	if extPat == nil {
 		return nil, nil, fmt.Errorf("pattern is empty")
 	}
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		return nil, nil, err
 	}
 	defer db.Close()
 	mcpExtractList := []mcpExtractEnt{}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			if matchFilter(&l) {
 				a := extPat.ExtReg.FindAllStringSubmatch(l, -1)
@@ -672,9 +638,11 @@ func extractDataFromLog(ctx context.Context, req *mcp.CallToolRequest, args extr
 					mcpExtractList = append(mcpExtractList, mcpExtractEnt{Time: time.Unix(0, t).Format(time.RFC3339Nano), Value: a[extPat.Index-1][1]})
 				}
 			}
-		}
-		return nil
-	})
+			return true
+		})
+	}); err != nil {
+		return nil, nil, err
+	}
 	j, err := json.Marshal(&mcpExtractList)
 	if err != nil {
 		j = []byte(err.Error())
@@ -721,14 +689,59 @@ func extractDataFromLogPrompt(ctx context.Context, req *mcp.GetPromptRequest) (*
 }
 
 type importLogParams struct {
-	Path    string `json:"path" jsonschema:"Log file or directory path to import.Files inside archive files such as zip, tar.gz, gz, etc. can be targeted for import."`
-	Pattern string `json:"pattern" jsonschema:"Log file name regular expression pattern filter to import.This applies to files in directories and files in archive files such as ZIP."`
+	Path        string   `json:"path" jsonschema:"Log file or directory path to import.Files inside archive files such as zip, tar, gz, bz2, xz, zst and nested archives can be targeted for import."`
+	Pattern     string   `json:"pattern" jsonschema:"Log file name regular expression pattern filter to import.This applies to files in directories and files in archive files such as ZIP."`
+	Recursive   bool     `json:"recursive,omitempty" jsonschema:"Import files in subdirectories of the directory."`
+	Include     []string `json:"include,omitempty" jsonschema:"File name patterns to import from the directory. Pattern with / matches the relative path."`
+	Exclude     []string `json:"exclude,omitempty" jsonschema:"File or directory name patterns to skip."`
+	Newer       string   `json:"newer,omitempty" jsonschema:"Import files modified after this time or duration ago like 7d."`
+	Older       string   `json:"older,omitempty" jsonschema:"Import files modified before this time or duration ago like 1h."`
+	FollowLinks bool     `json:"followLinks,omitempty" jsonschema:"Follow symbolic links to directories."`
+	TimeFormat  string   `json:"timeFormat,omitempty" jsonschema:"Timestamp format of logs in Go layout or strftime like %b %d %H:%M:%S."`
+	TZ          string   `json:"tz,omitempty" jsonschema:"Timezone of timestamps without offset like Asia/Tokyo."`
 }
 
 func importLog(ctx context.Context, req *mcp.CallToolRequest, args importLogParams) (*mcp.CallToolResult, any, error) {
 	var err error
 	filePat = args.Pattern
 	source = args.Path
+	dirRecursive = args.Recursive
+	dirIncludes = args.Include
+	dirExcludes = args.Exclude
+	dirNewer = args.Newer
+	dirOlder = args.Older
+	dirFollowLinks = args.FollowLinks
+	timeFormat = args.TimeFormat
+	timeZone = args.TZ
+	flags := []string{}
+	if filePat != "" {
+		flags = append(flags, "--filePat="+filePat)
+	}
+	if dirRecursive {
+		flags = append(flags, "--recursive=true")
+	}
+	for _, p := range dirIncludes {
+		flags = append(flags, "--include="+p)
+	}
+	for _, p := range dirExcludes {
+		flags = append(flags, "--exclude="+p)
+	}
+	if dirNewer != "" {
+		flags = append(flags, "--newer="+dirNewer)
+	}
+	if dirOlder != "" {
+		flags = append(flags, "--older="+dirOlder)
+	}
+	if dirFollowLinks {
+		flags = append(flags, "--followLinks=true")
+	}
+	if timeFormat != "" {
+		flags = append(flags, "--timeFormat="+timeFormat)
+	}
+	if timeZone != "" {
+		flags = append(flags, "--tz="+timeZone)
+	}
+	importFlags = strings.Join(flags, " ")
 	if source == "" {
 		return nil, nil, fmt.Errorf("path is empty")
 	}
@@ -736,9 +749,10 @@ func importLog(ctx context.Context, req *mcp.CallToolRequest, args importLogPara
 		return nil, nil, err
 	}
 	defer db.Close()
-	totalFiles = 0
-	totalLines = 0
-	totalBytes = 0
+	if err := setupFields(); err != nil {
+		return nil, nil, err
+	}
+	setImportTotal(0, 0, 0)
 	setupTimeGrinder()
 	logCh = make(chan *LogEnt, 10000)
 	var wg sync.WaitGroup
@@ -754,9 +768,10 @@ func importLog(ctx context.Context, req *mcp.CallToolRequest, args importLogPara
 		Lines string
 		Bytes string
 	}
-	r.Files = humanize.Bytes(uint64(totalFiles))
-	r.Lines = humanize.Bytes(uint64(totalLines))
-	r.Bytes = humanize.Bytes(uint64(totalBytes))
+	tf, tl, tb := getImportTotal()
+	r.Files = humanize.Bytes(uint64(tf))
+	r.Lines = humanize.Bytes(uint64(tl))
+	r.Bytes = humanize.Bytes(uint64(tb))
 	j, err := json.Marshal(&r)
 	if err != nil {
 		j = []byte(err.Error())
@@ -780,116 +795,24 @@ func mcpImport(path string) error {
 }
 
 func mcpImportFromFile(path string) error {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".zip":
-		return mcpImportFromZIPFile(path)
-	case ".evtx":
-		return mcpImportFromWindowsEvtx(path)
-	case ".tgz":
-		return mcpImportFromTarGZFile(path)
-	case ".gz":
-		if strings.HasSuffix(path, ".tar.gz") {
-			return mcpImportFromTarGZFile(path)
-		}
-	}
 	r, err := os.Open(path)
-	if err != nil {
-		log.Panicln(err)
-	}
-	defer r.Close()
-	if ext == ".gz" {
-		if gzr, err := gzip.NewReader(r); err == nil {
-			return mcpDoImport(gzr)
-		} else {
-			return err
-		}
-	}
-	return mcpDoImport(r)
-}
-
-func mcpImportFromZIPFile(path string) error {
-	r, err := zip.OpenReader(path)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
-	filter := getSimpleFilter(filePat)
-	for _, f := range r.File {
-		p := filepath.Base(f.Name)
-		if filter != nil && !filter.MatchString(p) {
-			continue
+	return walkArchive(path, r, getSimpleFilter(filePat), func(e *archiveEnt) error {
+		switch e.Kind {
+		case "evtx":
+			return mcpImportFromWindowsEvtx(e.Path, e.File)
+		case "journal":
+			return importFromJournalFile(e.Path, e.File)
 		}
-		r, err := f.Open()
-		if err != nil {
-			continue
-		}
-		ext := strings.ToLower(filepath.Ext(f.Name))
-		switch ext {
-		case ".gz":
-			if gzr, err := gzip.NewReader(r); err == nil {
-				mcpDoImport(gzr)
-			}
-		case ".evtx":
-			w, err := os.CreateTemp("", "winlog*.evtx")
-			if err != nil {
-				return err
-			}
-			defer os.Remove(w.Name())
-			io.Copy(w, r)
-			w.Close()
-			importFromWindowsEvtx(w.Name())
-		default:
-			if err := mcpDoImport(r); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
-func mcpImportFromTarGZFile(path string) error {
-	r, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-	gzr, err := gzip.NewReader(r)
-	if err != nil {
-		return err
-	}
-	filter := getSimpleFilter(filePat)
-	tgzr := tar.NewReader(gzr)
-	for {
-		f, err := tgzr.Next()
-		if err != nil {
-			return nil
-		}
-		if filter != nil && !filter.MatchString(f.Name) {
-			continue
-		}
-		if strings.HasSuffix(f.Name, ".gz") {
-			igzr, err := gzip.NewReader(tgzr)
-			if err != nil {
-				return err
-			}
-			if err := mcpDoImport(igzr); err != nil {
-				return err
-			}
-		} else {
-			if err := mcpDoImport(tgzr); err != nil {
-				return err
-			}
-		}
-	}
+		return mcpDoImport(e.Path, e.Reader)
+	})
 }
 
 func mcpImportFromDir(path string) error {
-	pat := "*"
-	if filePat != "" {
-		pat = filePat
-	}
-	files, err := filepath.Glob(filepath.Join(path, pat))
+	files, err := getDirFiles(path)
 	if err != nil {
 		return err
 	}
@@ -901,22 +824,34 @@ func mcpImportFromDir(path string) error {
 	return nil
 }
 
-func mcpDoImport(r io.Reader) error {
-	totalFiles++
+func mcpDoImport(path string, r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(fpSize)
+	if ok, err := importEntries(path, br, head); ok {
+		return err
+	}
+	addImportTotal(1, 0, 0)
 	lastTime := int64(0)
 	readLines := 0
-	hash := fmt.Sprintf("%04x", totalFiles)
-	scanner := bufio.NewScanner(r)
+	skipLines := 0
+	readBytes := int64(0)
+	hash := getSHA1(path)
+	te, err := newSourceTime(path, getSourceRefTime(path))
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(br)
 	for scanner.Scan() {
 		l := scanner.Text()
-		ts, ok, _ := tg.Extract([]byte(l))
+		ts, ok := te.extract([]byte(l))
 		if !ok {
+			skipLines++
 			continue
 		}
 		t := ts.UnixNano()
-		totalBytes += int64(len(l))
+		readBytes += int64(len(l))
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, int64(len(l)))
 		d := 0
 		if lastTime > 0 {
 			d = int(t - lastTime)
@@ -930,11 +865,12 @@ func mcpDoImport(r io.Reader) error {
 			Line:  readLines,
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	return nil
 }
 
-func mcpImportFromWindowsEvtx(path string) error {
-	r, err := os.Open(path)
+func mcpImportFromWindowsEvtx(path, file string) error {
+	r, err := os.Open(file)
 	if err != nil {
 		return err
 	}
@@ -949,8 +885,9 @@ func mcpImportFromWindowsEvtx(path string) error {
 			return err
 		}
 	}
-	totalFiles++
+	addImportTotal(1, 0, 0)
 	hash := getSHA1(path)
+	readBytes := int64(0)
 	readLines := 0
 	skipLines := 0
 	for e := range ef.FastEvents() {
@@ -959,7 +896,7 @@ func mcpImportFromWindowsEvtx(path string) error {
 			continue
 		}
 		readLines++
-		totalLines++
+		addImportTotal(0, 1, 0)
 		syst, err := e.GetTime(&evtx.SystemTimePath)
 		if err != nil {
 			skipLines++
@@ -967,7 +904,8 @@ func mcpImportFromWindowsEvtx(path string) error {
 		}
 		t := syst.UnixNano()
 		l := string(evtx.ToJSON(e))
-		totalBytes += int64(len(l))
+		addImportTotal(0, 0, int64(len(l)))
+		readBytes += int64(len(l))
 		logCh <- &LogEnt{
 			Time: t,
 			Log:  l,
@@ -975,6 +913,7 @@ func mcpImportFromWindowsEvtx(path string) error {
 			Line: readLines,
 		}
 	}
+	recordSource(path, hash, readBytes, readLines, skipLines)
 	return nil
 }
 
@@ -1032,13 +971,12 @@ func summaryLog(ctx context.Context, req *mcp.CallToolRequest, args summaryLogPa
 		topN = 10
 	}
 	setupFilter([]string{})
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		return nil, nil, err
 	}
 	defer db.Close()
 	results = []string{}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	errorLogMap := make(map[string]*aiErrorPattern)
 	setupTimeGrinder()
 	aiStartTime = time.Now().Add(time.Hour * 24 * 365 * 100).UnixNano()
@@ -1046,25 +984,15 @@ func summaryLog(ctx context.Context, req *mcp.CallToolRequest, args summaryLogPa
 	aiErrorCount = 0
 	aiWarningCount = 0
 	aiTotalEntries = 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			if matchFilter(&l) {
 				level := getAILogLevel(&l)
 				switch level {
 				case "ERROR":
 					aiErrorCount++
-					nl := normalizeLog(l)
+					nl := normalizeLog(tg, l)
 					if p, ok := errorLogMap[nl]; !ok {
 						errorLogMap[nl] = &aiErrorPattern{
 							Pattern: nl,
@@ -1086,9 +1014,11 @@ func summaryLog(ctx context.Context, req *mcp.CallToolRequest, args summaryLogPa
 				}
 				aiTotalEntries++
 			}
-		}
-		return nil
-	})
+			return true
+		})
+	}); err != nil {
+		return nil, nil, err
+	}
 	aiErrorPatternList = []*aiErrorPattern{}
 	for _, v := range errorLogMap {
 		aiErrorPatternList = append(aiErrorPatternList, v)
@@ -39,9 +39,10 @@ import (
 )
 
 type relationDataEnt struct {
-	Name  string
-	Reg   *regexp.Regexp
-	Index int
+	Name   string
+	Reg    *regexp.Regexp
+	Index  int
+	Column string
 }
 
 var relationCheckList = []relationDataEnt{}
@@ -52,7 +53,7 @@ var relationCmd = &cobra.Command{
 	Short: "Relation Analysis",
 	Long: `Analyzes the relationship between two or more pieces of data extracted from a log, 
 such as the relationship between an IP address and a MAC address.
-data entry is ip | mac | email | url | regex/<pattern>/<color> 
+data entry is ip | mac | email | url | regex/<pattern>/<color> | col/<column name>
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		fargs := []string{}
@@ -88,6 +89,11 @@ data entry is ip | mac | email | url | regex/<pattern>/<color>
 					Reg:   regexpKV,
 					Index: getRelationEntIndex(e),
 				})
+			case strings.HasPrefix(e, "col/"):
+				relationCheckList = append(relationCheckList, relationDataEnt{
+					Name:   e,
+					Column: strings.TrimPrefix(e, "col/"),
+				})
 			case strings.HasPrefix(e, "regex/") || strings.HasPrefix(e, "regexp/"):
 				{
 					a := strings.Split(e, "/")
@@ -136,7 +142,7 @@ func init() {
 
 func relationMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -149,6 +155,7 @@ func relationMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type relationEnt struct {
@@ -163,26 +170,24 @@ func relationSub(wg *sync.WaitGroup) {
 	var relationMap = make(map[string]*relationEnt)
 	defer wg.Done()
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	i := 0
 	hit := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		cols := getColumnMap(tx)
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			i++
 			if matchFilter(&l) {
 				var vals = []string{}
 				for _, r := range relationCheckList {
+					if r.Column != "" {
+						c, ok := cols.value(k, l, r.Column)
+						if !ok {
+							break
+						}
+						vals = append(vals, c)
+						continue
+					}
 					a := r.Reg.FindAllString(l, -1)
 					if len(a) < r.Index+1 {
 						break
@@ -190,7 +195,7 @@ func relationSub(wg *sync.WaitGroup) {
 					vals = append(vals, a[r.Index])
 				}
 				if len(vals) != len(relationCheckList) {
-					continue
+					return true
 				}
 				hit++
 				key := strings.Join(vals, "\t")
@@ -208,10 +213,10 @@ func relationSub(wg *sync.WaitGroup) {
 				teaProg.Send(SearchMsg{Lines: i, Hit: hit, Dur: time.Since(st)})
 			}
 			if stopSearch {
-				break
+				return false
 			}
-		}
-		return nil
+			return true
+		})
 	})
 	for _, v := range relationMap {
 		relationList = append(relationList, v)
@@ -58,6 +58,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&regexpFilter, "regex", "r", "", "Regexp filter")
 	rootCmd.PersistentFlags().StringVarP(&notFilter, "not", "v", "", "Invert regexp filter")
 	rootCmd.PersistentFlags().BoolVar(&sixelChart, "sixel", false, "show chart by sixel")
+	rootCmd.PersistentFlags().IntVar(&scanWorkers, "workers", 0, "Number of scan workers (0 is number of CPUs)")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,224 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"runtime"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// Parallel scan
+//
+// One goroutine reads logs in time range and passes batches of logs to workers.
+// Each worker has its own read transaction, so it can read other buckets like fields.
+// The results of workers are merged in the caller goroutine,
+// in log order when ordered is true.
+
+var scanWorkers int
+
+// scanBatchSize : number of logs passed to worker at once
+const scanBatchSize = 256
+
+// logEnt : log read by scan
+type logEnt struct {
+	Time  int64
+	Key   []byte
+	Log   string
+	Delta []byte
+}
+
+type scanOpt struct {
+	// Merge results in log order
+	Ordered bool
+	// Read delta of logs
+	Delta bool
+	// Called every 100 logs and at the end of scan
+	Progress func(lines, hit int)
+}
+
+type scanJob[R any] struct {
+	seq  int
+	logs []*logEnt
+	res  []R
+	ok   []bool
+}
+
+func getScanWorkers() int {
+	if scanWorkers > 0 {
+		return scanWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// scanLogsParallel : scan logs in time range with workers.
+// newWorker makes the function to filter and extract log for each worker.
+// merge is called for logs accepted by worker and stops scan when it returns false.
+// Scan also stops when stopSearch is set. Returns number of scanned and accepted logs,
+// and error of scan like broken block.
+func scanLogsParallel[R any](sti, eti int64, opt scanOpt,
+	newWorker func(tx *bbolt.Tx) func(e *logEnt) (R, bool),
+	merge func(e *logEnt, r R) bool) (int, int, error) {
+	lines, hit := 0, 0
+	progress := func() {
+		if opt.Progress != nil {
+			opt.Progress(lines, hit)
+		}
+	}
+	defer progress()
+	n := getScanWorkers()
+	if n < 2 {
+		err := db.View(func(tx *bbolt.Tx) error {
+			work := newWorker(tx)
+			bd := tx.Bucket([]byte("delta"))
+			return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
+				e := &logEnt{Time: t, Key: k, Log: string(v)}
+				if opt.Delta && bd != nil {
+					e.Delta = bd.Get(k)
+				}
+				lines++
+				if r, ok := work(e); ok {
+					hit++
+					if !merge(e, r) {
+						return false
+					}
+				}
+				if lines%100 == 0 {
+					progress()
+				}
+				return !stopSearch
+			})
+		})
+		return lines, hit, err
+	}
+	jobs := make(chan *scanJob[R], n*2)
+	done := make(chan *scanJob[R], n*2)
+	quit := make(chan struct{})
+	// errCh gets error of scan when producer is done even if merge is stopped
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		errCh <- db.View(func(tx *bbolt.Tx) error {
+			bd := tx.Bucket([]byte("delta"))
+			seq := 0
+			j := &scanJob[R]{}
+			send := func() bool {
+				j.seq = seq
+				seq++
+				select {
+				case jobs <- j:
+				case <-quit:
+					return false
+				}
+				j = &scanJob[R]{}
+				return true
+			}
+			err := scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
+				e := &logEnt{Time: t, Key: append([]byte{}, k...), Log: string(v)}
+				if opt.Delta && bd != nil {
+					if d := bd.Get(k); d != nil {
+						e.Delta = append([]byte{}, d...)
+					}
+				}
+				j.logs = append(j.logs, e)
+				if len(j.logs) >= scanBatchSize {
+					return send() && !stopSearch
+				}
+				return true
+			})
+			if len(j.logs) > 0 {
+				send()
+			}
+			return err
+		})
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.View(func(tx *bbolt.Tx) error {
+				work := newWorker(tx)
+				for j := range jobs {
+					j.res = make([]R, len(j.logs))
+					j.ok = make([]bool, len(j.logs))
+					for i, e := range j.logs {
+						j.res[i], j.ok[i] = work(e)
+					}
+					select {
+					case done <- j:
+					case <-quit:
+						return nil
+					}
+				}
+				return nil
+			})
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	stopped := false
+	stop := func() {
+		if !stopped {
+			stopped = true
+			close(quit)
+		}
+	}
+	mergeJob := func(j *scanJob[R]) {
+		for i, e := range j.logs {
+			lines++
+			if j.ok[i] {
+				hit++
+				if !merge(e, j.res[i]) {
+					stop()
+					return
+				}
+			}
+			if lines%100 == 0 {
+				progress()
+			}
+			if stopSearch {
+				stop()
+				return
+			}
+		}
+	}
+	pending := make(map[int]*scanJob[R])
+	next := 0
+	for j := range done {
+		if stopped {
+			continue
+		}
+		if !opt.Ordered {
+			mergeJob(j)
+			continue
+		}
+		pending[j.seq] = j
+		for !stopped {
+			pj, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			mergeJob(pj)
+		}
+	}
+	return lines, hit, <-errCh
+}
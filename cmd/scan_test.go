@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestScanLogsParallel(t *testing.T) {
+	defer func() {
+		scanWorkers = 0
+	}()
+	timeRange = ""
+	sourceFilter = ""
+	setupFilter([]string{})
+	dataStore = filepath.Join(t.TempDir(), "twsla.db")
+	if err := openDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	logs := []logBufEnt{}
+	for i := 0; i < 5000; i++ {
+		logs = append(logs, logBufEnt{
+			ID:    []byte(fmt.Sprintf("%016x:00:%x", i, i)),
+			Log:   []byte(fmt.Sprintf("log %d %s", i, []string{"even", "odd"}[i%2])),
+			Delta: []byte(fmt.Sprintf("%d", i)),
+		})
+	}
+	if err := saveLogs(logs, getDataStoreInfo()); err != nil {
+		t.Fatal(err)
+	}
+	newWorker := func(tx *bbolt.Tx) func(e *logEnt) (int64, bool) {
+		return func(e *logEnt) (int64, bool) {
+			return e.Time, strings.HasSuffix(e.Log, "odd")
+		}
+	}
+	tests := []struct {
+		workers int
+		ordered bool
+		max     int
+		lines   int
+		hit     int
+	}{
+		{workers: 1, ordered: true, lines: 5000, hit: 2500},
+		{workers: 4, ordered: true, lines: 5000, hit: 2500},
+		{workers: 4, ordered: false, lines: 5000, hit: 2500},
+		{workers: 4, ordered: true, max: 100, lines: 200, hit: 100},
+		{workers: 1, ordered: true, max: 100, lines: 200, hit: 100},
+	}
+	for _, tt := range tests {
+		scanWorkers = tt.workers
+		got := []int64{}
+		delta := 0
+		progress := 0
+		lines, hit, err := scanLogsParallel(0, math.MaxInt64, scanOpt{
+			Ordered: tt.ordered,
+			Delta:   true,
+			Progress: func(lines, hit int) {
+				progress = lines
+			},
+		}, newWorker, func(e *logEnt, r int64) bool {
+			if string(e.Delta) == fmt.Sprintf("%d", r) {
+				delta++
+			}
+			got = append(got, r)
+			return tt.max == 0 || len(got) < tt.max
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines != tt.lines || hit != tt.hit || progress != tt.lines {
+			t.Errorf("workers=%d ordered=%v got lines=%d hit=%d progress=%d", tt.workers, tt.ordered, lines, hit, progress)
+		}
+		if delta != len(got) {
+			t.Errorf("workers=%d delta got %d, want %d", tt.workers, delta, len(got))
+		}
+		sum := int64(0)
+		for i, r := range got {
+			sum += r
+			if tt.ordered && r != int64(i*2+1) {
+				t.Errorf("workers=%d ordered got %d at %d", tt.workers, r, i)
+				break
+			}
+		}
+		if tt.max == 0 && sum != 2500*2500 {
+			t.Errorf("workers=%d ordered=%v sum got %d", tt.workers, tt.ordered, sum)
+		}
+	}
+}
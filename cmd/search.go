@@ -21,7 +21,6 @@ import (
 	"log"
 	"os"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -71,11 +70,12 @@ func init() {
 	rootCmd.AddCommand(searchCmd)
 	searchCmd.Flags().StringVarP(&colorMode, "color", "c", "", "Color mode")
 	searchCmd.Flags().BoolVarP(&wrap, "wrap", "w", false, "Wrap or scroll x.")
+	searchCmd.Flags().StringVar(&sourceFilter, "source", "", "Source path filter")
 }
 
 func searchMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -88,6 +88,7 @@ func searchMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type colorMapEnt struct {
@@ -100,20 +101,9 @@ func searchSub(wg *sync.WaitGroup) {
 	makeColorList()
 	results = []string{}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
 	i := 0
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
+	scanErr = db.View(func(tx *bbolt.Tx) error {
+		return scanLogs(tx, sti, eti, func(t int64, k, v []byte) bool {
 			l := string(v)
 			i++
 			if matchFilter(&l) {
@@ -123,10 +113,10 @@ func searchSub(wg *sync.WaitGroup) {
 				teaProg.Send(SearchMsg{Lines: i, Hit: len(results), Dur: time.Since(st)})
 			}
 			if stopSearch {
-				break
+				return false
 			}
-		}
-		return nil
+			return true
+		})
 	})
 	teaProg.Send(SearchMsg{Done: true, Lines: i, Hit: len(results), Dur: time.Since(st)})
 }
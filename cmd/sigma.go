@@ -25,7 +25,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -88,7 +87,7 @@ type sigmaMsg struct {
 
 func sigmaMain() {
 	st = time.Now()
-	if err := openDB(); err != nil {
+	if err := openDBReadOnly(); err != nil {
 		log.Fatalln(err)
 	}
 	defer db.Close()
@@ -101,6 +100,7 @@ func sigmaMain() {
 		os.Exit(1)
 	}
 	wg.Wait()
+	checkScanErr()
 }
 
 type sigmaEnt struct {
@@ -178,12 +178,12 @@ func matchSigmaRule(l *string) *evaluator.RuleEvaluator {
 	var data interface{}
 	if gr != nil {
 		var err error
-		data, err = gr.ParseString(*l)
+		data, err = parseGrok(*l)
 		if err != nil {
 			return nil
 		}
 	} else {
-		if err := json.Unmarshal([]byte(*l), &data); err != nil {
+		if err := json.Unmarshal([]byte(trimHostTag(*l)), &data); err != nil {
 			return nil
 		}
 	}
@@ -205,43 +205,32 @@ var sigmaList = []sigmaEnt{}
 func sigmaSub(wg *sync.WaitGroup) {
 	defer wg.Done()
 	loadSigmaRules()
+	setStoredGrok()
 	setGrok()
 	results = []string{}
 	sti, eti := getTimeRange()
-	sk := fmt.Sprintf("%016x:", sti)
-	db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("logs"))
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			a := strings.Split(string(k), ":")
-			if len(a) < 1 {
-				continue
-			}
-			t, err := strconv.ParseInt(a[0], 16, 64)
-			if err == nil && t > eti {
-				break
-			}
-			l := string(v)
-			lines++
-			if matchFilter(&l) {
-				hit++
-				if ev := matchSigmaRule(&l); ev != nil {
-					results = append(results, l)
-					times = append(times, t)
-					sigmaList = append(sigmaList, sigmaEnt{
-						Log:       len(sigmaList),
-						Evaluator: ev,
-					})
-				}
-			}
-			if lines%100 == 0 {
-				teaProg.Send(sigmaMsg{Lines: lines, Hit: hit, Match: len(sigmaList), Dur: time.Since(st)})
-			}
-			if stopSearch {
-				break
+	lines, hit, scanErr = scanLogsParallel(sti, eti, scanOpt{
+		Ordered: true,
+		Progress: func(lines, hit int) {
+			teaProg.Send(sigmaMsg{Lines: lines, Hit: hit, Match: len(sigmaList), Dur: time.Since(st)})
+		},
+	}, func(tx *bbolt.Tx) func(e *logEnt) (*evaluator.RuleEvaluator, bool) {
+		return func(e *logEnt) (*evaluator.RuleEvaluator, bool) {
+			if !matchFilter(&e.Log) {
+				return nil, false
 			}
+			return matchSigmaRule(&e.Log), true
 		}
-		return nil
+	}, func(e *logEnt, ev *evaluator.RuleEvaluator) bool {
+		if ev != nil {
+			results = append(results, e.Log)
+			times = append(times, e.Time)
+			sigmaList = append(sigmaList, sigmaEnt{
+				Log:       len(sigmaList),
+				Evaluator: ev,
+			})
+		}
+		return true
 	})
 	teaProg.Send(sigmaMsg{Done: true, Lines: lines, Hit: hit, Match: len(sigmaList), Dur: time.Since(st)})
 }
@@ -0,0 +1,348 @@
+/*
+Copyright © 2024 Masayuki Yamai <twsnmp@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.etcd.io/bbolt"
+)
+
+// sourceEnt : import provenance saved in sources bucket.
+// The key of sources bucket is the ID used in log keys.
+type sourceEnt struct {
+	ID         string
+	Path       string
+	Type       string
+	Size       int64
+	ModTime    int64
+	Bytes      int64
+	Lines      int
+	Skip       int
+	ImportTime int64
+	Flags      string
+	// Content fingerprint and offset of imported lines for resume
+	Fingerprint string
+	FPLen       int
+	Offset      int64
+	OffsetLine  int
+	// Column names from header line of W3C, Zeek or CSV/TSV log
+	Columns   []string `json:",omitempty"`
+	ColumnSep string   `json:",omitempty"`
+	// Host is the name of inventory host. Logs have the tag of host.
+	Host string `json:",omitempty"`
+}
+
+// fpSize : max size of the head of source used for fingerprint
+const fpSize = 4096
+
+// minFPLen : fingerprint shorter than this is used for the same path only,
+// because small files such as header only CSV may have the same content.
+const minFPLen = 1024
+
+var importFlags string
+var sourceFilter string
+var noResume bool
+
+// sourceIDLen : length of source ID in log keys of datastore
+var sourceIDLen = 8
+
+// legacySourceIDLen : length of source ID in datastore made before sources bucket
+const legacySourceIDLen = 2
+
+// sourcesCmd represents the sources command
+var sourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "List import sources",
+	Long: `List import sources recorded in datastore.
+ID is the source ID in log keys and can be used to identify the source of logs.
+Datastore made by old version uses 2 chars ID, and logs imported by old version
+have no source. Logs of other source may have the same 2 chars ID.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sourcesMain()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sourcesCmd)
+	sourcesCmd.Flags().BoolVar(&jsonOut, "jsonOut", false, "output json format")
+	sourcesCmd.Flags().StringVar(&sourceFilter, "source", "", "Source path filter")
+}
+
+func sourcesMain() {
+	if err := openDBReadOnly(); err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	filter := getSimpleFilter(sourceFilter)
+	for _, s := range getSources() {
+		if filter != nil && !filter.MatchString(s.Path) {
+			continue
+		}
+		if jsonOut {
+			j, err := json.Marshal(s)
+			if err != nil {
+				continue
+			}
+			fmt.Println(string(j))
+		} else {
+			mt := ""
+			if s.ModTime > 0 {
+				mt = time.Unix(0, s.ModTime).Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				s.ID, s.Type, s.Path,
+				humanize.Comma(int64(s.Lines)), humanize.Comma(int64(s.Skip)),
+				humanize.Bytes(uint64(s.Size)), mt,
+				time.Unix(0, s.ImportTime).Format(time.RFC3339),
+				s.Flags)
+		}
+	}
+}
+
+func getSources() []*sourceEnt {
+	r := []*sourceEnt{}
+	db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sources"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s sourceEnt
+			if err := json.Unmarshal(v, &s); err == nil {
+				r = append(r, &s)
+			}
+			return nil
+		})
+	})
+	return r
+}
+
+// recordSource : save import provenance of source
+func recordSource(path, id string, bytes int64, lines, skip int) {
+	saveSource(newSourceEnt(path, id, bytes, lines, skip))
+}
+
+func newSourceEnt(path, id string, bytes int64, lines, skip int) *sourceEnt {
+	s := &sourceEnt{
+		ID:         id,
+		Path:       redactURL(path),
+		Type:       getPathType(path),
+		Bytes:      bytes,
+		Size:       bytes,
+		Lines:      lines,
+		Skip:       skip,
+		ImportTime: time.Now().UnixNano(),
+		Flags:      importFlags,
+	}
+	if s.Type == "" && isArchiveMember(path) {
+		s.Type = "archive"
+	}
+	if s.Type == "" {
+		// Path of TWSNMP, syslog and email is not URL
+		s.Type = getSourceType()
+	}
+	if s.Type == "" {
+		s.Type = "api"
+	}
+	if host, _ := getHostTag(path); host != "" {
+		s.Type = "ssh"
+		s.Host = host
+	}
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+		s.Type = "file"
+		s.Size = fi.Size()
+		s.ModTime = fi.ModTime().UnixNano()
+	}
+	return s
+}
+
+// isArchiveMember : path is file in local archive like x.tar.gz:a.log
+func isArchiveMember(path string) bool {
+	for i := strings.IndexByte(path, ':'); i > 0; {
+		if fi, err := os.Stat(path[:i]); err == nil && !fi.IsDir() {
+			return true
+		}
+		n := strings.IndexByte(path[i+1:], ':')
+		if n < 0 {
+			break
+		}
+		i += n + 1
+	}
+	return false
+}
+
+func saveSource(s *sourceEnt) {
+	j, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("sources"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(s.ID), j)
+	})
+}
+
+// getFingerprint : get fingerprint of the head of source
+func getFingerprint(head []byte) string {
+	h := sha1.Sum(head)
+	return hex.EncodeToString(h[:])
+}
+
+// findSource : find imported source that has the same head
+func findSource(path string, head []byte) *sourceEnt {
+	var r *sourceEnt
+	db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sources"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s sourceEnt
+			if err := json.Unmarshal(v, &s); err != nil {
+				return nil
+			}
+			if s.FPLen < 1 || s.FPLen > len(head) || s.Fingerprint != getFingerprint(head[:s.FPLen]) {
+				return nil
+			}
+			if s.FPLen < minFPLen && s.Path != redactURL(path) {
+				return nil
+			}
+			if r == nil || s.FPLen > r.FPLen || (s.FPLen == r.FPLen && s.Offset > r.Offset) {
+				r = &s
+			}
+			return nil
+		})
+	})
+	return r
+}
+
+// redactURL : hide password in source URL
+func redactURL(s string) string {
+	a := strings.Split(s, " ")
+	for i, e := range a {
+		if !strings.Contains(e, "://") {
+			continue
+		}
+		if u, err := url.Parse(e); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				a[i] = u.Redacted()
+			}
+		}
+	}
+	return strings.Join(a, " ")
+}
+
+// getChangedFlags : get flags set on command line for source record
+func getChangedFlags(cmd *cobra.Command) string {
+	a := []string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		switch f.Name {
+		case "source", "datastore", "emailPassword":
+			return
+		case "header":
+			// Values of header like token are not recorded
+			h, _ := cmd.Flags().GetStringArray(f.Name)
+			for _, v := range h {
+				n, _, _ := strings.Cut(v, ":")
+				a = append(a, fmt.Sprintf("--%s=%s: ***", f.Name, strings.TrimSpace(n)))
+			}
+			return
+		}
+		a = append(a, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	return strings.Join(a, " ")
+}
+
+// getSourceIDFilter : get IDs of sources matching source filter.
+// Error is datastore that has no sources like made by old version.
+func getSourceIDFilter(tx *bbolt.Tx) (map[string]bool, error) {
+	if sourceFilter == "" {
+		return nil, nil
+	}
+	r := make(map[string]bool)
+	filter := getSimpleFilter(sourceFilter)
+	b := tx.Bucket([]byte("sources"))
+	if b == nil {
+		return nil, fmt.Errorf("datastore has no sources for source filter. logs imported by old version have no source")
+	}
+	if filter == nil {
+		return r, nil
+	}
+	b.ForEach(func(k, v []byte) error {
+		var s sourceEnt
+		if err := json.Unmarshal(v, &s); err == nil && filter.MatchString(s.Path) {
+			r[string(k)] = true
+		}
+		return nil
+	})
+	return r, nil
+}
+
+// getSourceIDLen : get length of source ID of datastore.
+// Datastore that has logs without meta and sources is made by old version.
+func getSourceIDLen(tx *bbolt.Tx) int {
+	if n, err := strconv.Atoi(getMeta(tx, "sourceID")); err == nil && n > 0 {
+		return n
+	}
+	if tx.Bucket([]byte("sources")) == nil {
+		if k, _ := tx.Bucket([]byte("logs")).Cursor().First(); k != nil {
+			return legacySourceIDLen
+		}
+	}
+	return 8
+}
+
+// setupSourceID : keep length of source ID in meta.
+// Import to datastore made by old version uses the same key, so logs are not duplicated.
+func setupSourceID(tx *bbolt.Tx) error {
+	sourceIDLen = getSourceIDLen(tx)
+	return setMeta(tx, "sourceID", strconv.Itoa(sourceIDLen))
+}
+
+// newSourceID : make source ID of log keys from key of source.
+// Datastore made by old version uses oldKey that old version used for the same logs.
+func newSourceID(key, oldKey string) string {
+	if sourceIDLen == legacySourceIDLen {
+		return getSHA1(oldKey)
+	}
+	return getSHA1(key)
+}
+
+// getSourceID : get source ID from log key
+func getSourceID(k []byte) string {
+	a := strings.SplitN(string(k), ":", 3)
+	if len(a) < 3 {
+		return ""
+	}
+	return a[1]
+}
@@ -69,6 +69,7 @@ twsla twlogeye <target> [<sub target>] [<anomaly report type>]
 				}
 			}
 		}
+		importFlags = getChangedFlags(cmd)
 		twLogEyeMain()
 	},
 }
@@ -91,6 +92,9 @@ func twLogEyeMain() {
 		log.Fatalln(err)
 	}
 	defer db.Close()
+	if err := setupFields(); err != nil {
+		log.Fatalln(err)
+	}
 	teaProg = tea.NewProgram(initImportModel())
 	logCh = make(chan *LogEnt, 10000)
 	var wg sync.WaitGroup
@@ -207,9 +211,8 @@ func getTwLogEyeNotify() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -278,9 +281,8 @@ func getTwLogEyeLogs() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -350,9 +352,8 @@ func getTwLogEyeSyslogReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -416,9 +417,8 @@ func getTwLogEyeTrapReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -498,9 +498,8 @@ func getTwLogEyeNetflowReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -570,9 +569,8 @@ func getTwLogEyeWindowsEventReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -650,9 +648,8 @@ func getTwLogEyeOTelReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -716,9 +713,8 @@ func getTwLogEyeMqttReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -794,9 +790,8 @@ func getTwLogEyeMonitorReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -861,9 +856,8 @@ func getTwLogEyeAnomalyReport() {
 			})
 		}
 	}
-	totalBytes = readBytes
-	totalLines = i
-	totalFiles = 1
+	setImportTotal(1, i, readBytes)
+	recordSource(path, hash, readBytes, i, 0)
 	teaProg.Send(ImportMsg{Done: false, Path: path, Bytes: readBytes, Lines: i})
 	teaProg.Send(ImportMsg{Done: true})
 }
@@ -25,6 +25,7 @@ require (
 	github.com/fatih/color v1.17.0
 	github.com/go-echarts/go-echarts/v2 v2.4.1
 	github.com/gravwell/gravwell/v3 v3.8.31
+	github.com/klauspost/compress v1.18.0
 	github.com/knadh/go-pop3 v1.0.0
 	github.com/mattn/go-sixel v0.0.5
 	github.com/modelcontextprotocol/go-sdk v1.4.1
@@ -33,10 +34,12 @@ require (
 	github.com/oschwald/geoip2-golang v1.11.0
 	github.com/rhysd/go-github-selfupdate v1.2.3
 	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.19.0
 	github.com/tmc/langchaingo v0.1.13
 	github.com/twsnmp/twlogeye/api v0.4.0
 	github.com/twsnmp/twsnmpfc/client v0.0.0-20240913214048-858814736e0b
+	github.com/ulikunitz/xz v0.5.15
 	github.com/viant/afs v1.25.1
 	github.com/wcharczuk/go-chart/v2 v2.1.1
 	github.com/xhit/go-str2duration/v2 v2.1.0
@@ -44,6 +47,7 @@ require (
 	golang.org/x/crypto v0.48.0
 	golang.org/x/text v0.35.0
 	google.golang.org/grpc v1.79.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -130,10 +134,8 @@ require (
 	github.com/sourcegraph/conc v0.3.0 // indirect
 	github.com/spf13/afero v1.11.0 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/subosito/gotenv v1.6.0 // indirect
 	github.com/tcnksm/go-gitconfig v0.1.2 // indirect
-	github.com/ulikunitz/xz v0.5.15 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	github.com/yargevad/filepathx v1.0.0 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
@@ -160,5 +162,4 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )